@@ -0,0 +1,14 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeaddrinuse is the Winsock error for an address already in use
+const wsaeaddrinuse = syscall.Errno(10048)
+
+// isAddrInUse reports whether a listen error means the port is taken
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeaddrinuse) || errors.Is(err, syscall.EADDRINUSE)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// clientAssertionType identifies a JWT client assertion (RFC 7523 §2.2)
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// defaultClientAssertionLifetime is how long a signed client assertion is valid
+const defaultClientAssertionLifetime = 60 * time.Second
+
+// loadAssertionKey reads an unencrypted PEM private key (PKCS #8, PKCS #1 or SEC 1)
+func loadAssertionKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client assertion key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("client assertion key '%s' is not PEM encoded", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported client assertion key type '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid client assertion key: %v", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("client assertion key must be an RSA or EC key")
+}
+
+// assertionAlg returns the signing algorithm for a key, defaulting to RS256
+// for RSA keys and ES256 for P-256 keys
+func assertionAlg(key crypto.Signer, alg string) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		switch alg {
+		case "":
+			return "RS256", nil
+		case "RS256", "PS256":
+			return alg, nil
+		}
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return "", fmt.Errorf("EC client assertion keys must use the P-256 curve")
+		}
+		if alg == "" || alg == "ES256" {
+			return "ES256", nil
+		}
+	}
+	return "", fmt.Errorf("algorithm '%s' is not supported for this client assertion key (use RS256 or PS256 for RSA, ES256 for EC)", alg)
+}
+
+// signClientAssertion builds and signs a short-lived client assertion JWT
+// for the app (RFC 7523 §3), addressed to audience
+func signClientAssertion(appConfig AppConfig, audience string) (string, error) {
+	if appConfig.ClientAssertionKeyFile == "" {
+		return "", fmt.Errorf("%s requires client_assertion_key_file", AuthMethodPrivateKeyJWT)
+	}
+	key, err := loadAssertionKey(appConfig.ClientAssertionKeyFile)
+	if err != nil {
+		return "", err
+	}
+	alg, err := assertionAlg(key, appConfig.ClientAssertionAlg)
+	if err != nil {
+		return "", err
+	}
+
+	lifetime := defaultClientAssertionLifetime
+	if appConfig.ClientAssertionLifetime != "" {
+		lifetime, err = time.ParseDuration(appConfig.ClientAssertionLifetime)
+		if err != nil || lifetime <= 0 {
+			return "", fmt.Errorf("invalid client_assertion_lifetime '%s': must be a positive duration such as 60s", appConfig.ClientAssertionLifetime)
+		}
+	}
+
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if appConfig.ClientAssertionKID != "" {
+		header["kid"] = appConfig.ClientAssertionKID
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": appConfig.ClientID,
+		"sub": appConfig.ClientID,
+		"aud": audience,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	signature, err := signJWS(key, alg, []byte(signed))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signJWS signs a JWS signing input with the given algorithm
+func signJWS(key crypto.Signer, alg string, signed []byte) ([]byte, error) {
+	hash := hashForAlg(alg)
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		return rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, digest)
+	case strings.HasPrefix(alg, "PS"):
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+		return rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, digest, opts)
+	default:
+		// JWS encodes ECDSA signatures as the fixed-width concatenation R || S
+		ecKey := key.(*ecdsa.PrivateKey)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest)
+		if err != nil {
+			return nil, err
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature, nil
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeyFile writes a private key to a PEM file in the given encoding
+func writeKeyFile(t *testing.T, key crypto.Signer, blockType string) string {
+	t.Helper()
+
+	var der []byte
+	var err error
+	switch blockType {
+	case "RSA PRIVATE KEY":
+		der = x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey))
+	case "EC PRIVATE KEY":
+		der, err = x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+	default:
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return path
+}
+
+func TestSignClientAssertionRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		blockType string
+		alg       string
+		wantAlg   string
+	}{
+		{"RS256 default for PKCS #1", rsaKey, "RSA PRIVATE KEY", "", "RS256"},
+		{"RS256 for PKCS #8", rsaKey, "PRIVATE KEY", "RS256", "RS256"},
+		{"PS256", rsaKey, "PRIVATE KEY", "PS256", "PS256"},
+		{"ES256 default for SEC 1", ecKey, "EC PRIVATE KEY", "", "ES256"},
+		{"ES256 for PKCS #8", ecKey, "PRIVATE KEY", "ES256", "ES256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := AppConfig{
+				ClientID:                "client-1",
+				ClientAssertionKeyFile:  writeKeyFile(t, tt.key, tt.blockType),
+				ClientAssertionAlg:      tt.alg,
+				ClientAssertionKID:      "kid-1",
+				ClientAssertionLifetime: "2m",
+			}
+
+			assertion, err := signClientAssertion(appConfig, "https://idp.example.com/token")
+			if err != nil {
+				t.Fatalf("signClientAssertion: %v", err)
+			}
+			jwt, err := parseJWT(assertion)
+			if err != nil {
+				t.Fatalf("parseJWT: %v", err)
+			}
+			if err := jwt.VerifySignature(tt.key.Public()); err != nil {
+				t.Fatalf("VerifySignature: %v", err)
+			}
+
+			if alg := jwt.HeaderString("alg"); alg != tt.wantAlg {
+				t.Errorf("alg = %q, want %q", alg, tt.wantAlg)
+			}
+			if kid := jwt.HeaderString("kid"); kid != "kid-1" {
+				t.Errorf("kid = %q, want %q", kid, "kid-1")
+			}
+			for _, claim := range []string{"iss", "sub"} {
+				if got := jwt.ClaimString(claim); got != "client-1" {
+					t.Errorf("%s = %q, want %q", claim, got, "client-1")
+				}
+			}
+			if aud := jwt.Audience(); len(aud) != 1 || aud[0] != "https://idp.example.com/token" {
+				t.Errorf("aud = %v, want the token endpoint", aud)
+			}
+			if jwt.ClaimString("jti") == "" {
+				t.Error("jti is missing")
+			}
+			iat, _ := jwt.ClaimTime("iat")
+			exp, _ := jwt.ClaimTime("exp")
+			if exp.Sub(iat) != 2*time.Minute {
+				t.Errorf("lifetime = %v, want 2m", exp.Sub(iat))
+			}
+		})
+	}
+}
+
+func TestSignClientAssertionRejectsMismatchedAlg(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"RSA algorithm for an EC key", ecKey, "RS256"},
+		{"EC key on P-384", p384Key, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := AppConfig{
+				ClientID:               "client-1",
+				ClientAssertionKeyFile: writeKeyFile(t, tt.key, "PRIVATE KEY"),
+				ClientAssertionAlg:     tt.alg,
+			}
+			if _, err := signClientAssertion(appConfig, "https://idp.example.com/token"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
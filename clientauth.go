@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Token endpoint client authentication methods (RFC 7591 §2)
+const (
+	AuthMethodNone          = "none"
+	AuthMethodSecretBasic   = "client_secret_basic"
+	AuthMethodSecretPost    = "client_secret_post"
+	AuthMethodPrivateKeyJWT = "private_key_jwt"
+)
+
+// clientSecretEnv overrides the configured client secret for any app
+const clientSecretEnv = "OAUTH_UTIL_CLIENT_SECRET"
+
+// isSecretReference reports whether a value is a client secret reference
+// rather than a literal secret
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, "env:") || strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "cmd:")
+}
+
+// resolveSecretReference reads a secret from an env:NAME, file:PATH or cmd:COMMAND reference
+func resolveSecretReference(ctx context.Context, ref string) (string, error) {
+	kind, value, _ := strings.Cut(ref, ":")
+	switch kind {
+	case "env":
+		secret, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' is not set", value)
+		}
+		return secret, nil
+	case "file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read client secret file: %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case "cmd":
+		output, err := shellCommand(ctx, value).Output()
+		if err != nil {
+			return "", fmt.Errorf("client secret command failed: %v", err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	default:
+		return "", fmt.Errorf("invalid secret reference '%s' (expected env:, file: or cmd:)", ref)
+	}
+}
+
+// shellCommand runs a command line with the platform's shell, killing it
+// when ctx is cancelled
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// resolveClientSecret returns the client secret for an app, if any
+func resolveClientSecret(ctx context.Context, appConfig AppConfig) (string, error) {
+	if appConfig.ClientSecretRef != "" {
+		return resolveSecretReference(ctx, appConfig.ClientSecretRef)
+	}
+	return appConfig.ClientSecret, nil
+}
+
+// usesClientSecret reports whether an app authenticates with a client secret,
+// either through its configured method or because it has a saved secret
+func usesClientSecret(appConfig AppConfig) bool {
+	switch appConfig.TokenEndpointAuthMethod {
+	case AuthMethodSecretBasic, AuthMethodSecretPost:
+		return true
+	case "":
+		return appConfig.ClientSecret != "" || appConfig.ClientSecretRef != ""
+	}
+	return false
+}
+
+// tokenEndpointAuthMethod returns the client authentication method for an app,
+// defaulting to client_secret_basic for confidential clients, private_key_jwt
+// when a client assertion key is configured, and none otherwise
+func tokenEndpointAuthMethod(appConfig AppConfig) (string, error) {
+	switch appConfig.TokenEndpointAuthMethod {
+	case "":
+		if appConfig.ClientSecret != "" || appConfig.ClientSecretRef != "" {
+			return AuthMethodSecretBasic, nil
+		}
+		if appConfig.ClientAssertionKeyFile != "" {
+			return AuthMethodPrivateKeyJWT, nil
+		}
+		return AuthMethodNone, nil
+	case AuthMethodNone, AuthMethodSecretBasic, AuthMethodSecretPost, AuthMethodPrivateKeyJWT:
+		return appConfig.TokenEndpointAuthMethod, nil
+	default:
+		return "", fmt.Errorf("unsupported token endpoint auth method '%s'", appConfig.TokenEndpointAuthMethod)
+	}
+}
+
+// applyClientAuth adds client credentials to the headers or form body of a
+// request to endpoint using the app's configured authentication method
+func applyClientAuth(ctx context.Context, header http.Header, data url.Values, appConfig AppConfig, endpoint string) error {
+	method, err := tokenEndpointAuthMethod(appConfig)
+	if err != nil {
+		return err
+	}
+
+	if method == AuthMethodNone {
+		data.Set("client_id", appConfig.ClientID)
+		return nil
+	}
+
+	if method == AuthMethodPrivateKeyJWT {
+		// The assertion is addressed to the endpoint being called unless
+		// configured otherwise; some providers only accept their own URL
+		audience := appConfig.ClientAssertionAudience
+		if audience == "" {
+			audience = endpoint
+		}
+		assertion, err := signClientAssertion(appConfig, audience)
+		if err != nil {
+			return err
+		}
+		data.Set("client_id", appConfig.ClientID)
+		data.Set("client_assertion_type", clientAssertionType)
+		data.Set("client_assertion", assertion)
+		return nil
+	}
+
+	secret, err := resolveClientSecret(ctx, appConfig)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("%s requires a client secret", method)
+	}
+
+	switch method {
+	case AuthMethodSecretBasic:
+		// RFC 6749 §2.3.1: credentials are form-urlencoded before base64 encoding
+		credentials := url.QueryEscape(appConfig.ClientID) + ":" + url.QueryEscape(secret)
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	case AuthMethodSecretPost:
+		data.Set("client_id", appConfig.ClientID)
+		data.Set("client_secret", secret)
+	}
+	return nil
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/ohler55/ojg/jp"
@@ -11,15 +16,66 @@ import (
 )
 
 var (
-	clientID   string
-	domain     string
-	scope      string
-	port       string
-	appName    string
-	jsonOutput bool
-	jsonPath   string
+	clientID       string
+	domain         string
+	scope          string
+	port           string
+	appName        string
+	jsonOutput     bool
+	jsonPath       string
+	pkceMethod     string
+	clientSecret   string
+	authMethod     string
+	grantType      string
+	validateID     bool
+	redirectURI    string
+	noBrowser      bool
+	callbackTLS    bool
+	responseMode   string
+	username       string
+	passwordStdin  bool
+	waitTimeout    time.Duration
+	requestTimeout time.Duration
+
+	audience    string
+	authPrompt  string
+	loginHint   string
+	acrValues   string
+	maxAge      string
+	uiLocales   string
+	authParams  []string
+	tokenParams []string
+	unsetParams []string
+	saveParams  bool
+
+	introspect    bool
+	tokenTypeHint string
+
+	subjectTokenFrom   string
+	subjectTokenType   string
+	requestedTokenType string
+	exchangeScope      string
+	noCache            bool
+
+	endSession    bool
+	postLogoutURI string
+
+	revokeAccess  bool
+	revokeRefresh bool
+	revokeAll     bool
+
+	decodeAccess   bool
+	decodeVerify   bool
+	decodeJWKSFile string
 )
 
+// DecodedJWT is the JSON output of the decode command
+type DecodedJWT struct {
+	Header   map[string]interface{} `json:"header"`
+	Claims   map[string]interface{} `json:"payload"`
+	Verified *bool                  `json:"signature_verified,omitempty"`
+}
+
 var configureCmd = &cobra.Command{
 	Use:   "configure",
 	Short: "Configure OAuth2 app settings",
@@ -77,210 +133,460 @@ var loginCmd = &cobra.Command{
 			currentAppName = defaultAppName
 		}
 
-		// Start OAuth flow
-		oauth := NewOAuthFlow()
-		tokens, err := oauth.StartFlow(appConfig, port)
+		applyFlagOverrides(&appConfig)
+		if saveParams {
+			saveRequestParams(currentAppName)
+		}
+
+		// Obtain new tokens
+		tokens, err := obtainTokens(cmd.Context(), appConfig, flowOptions(cmd, currentAppName, appConfig))
 		if err != nil {
-			if jsonOutput {
-				errorResp := map[string]string{"error": err.Error()}
-				json.NewEncoder(os.Stderr).Encode(errorResp)
-			} else {
-				fmt.Fprintf(os.Stderr, "❌ Error during OAuth flow: %v\n", err)
-			}
-			os.Exit(1)
+			exitWithError("Error during OAuth flow", err)
 		}
 
 		// Save tokens if using a saved app configuration
 		if currentAppName != "" {
-			if err := saveTokensToApp(currentAppName, tokens); err != nil {
-				if jsonOutput {
-					errorResp := map[string]string{"error": fmt.Sprintf("Failed to save tokens: %v", err)}
-					json.NewEncoder(os.Stderr).Encode(errorResp)
-				} else {
-					fmt.Fprintf(os.Stderr, "⚠️  Warning: Failed to save tokens: %v\n", err)
-				}
-			} else if !jsonOutput {
-				color.Green("✅ Tokens saved to configuration for app '%s'", currentAppName)
+			persistTokens(currentAppName, tokens)
+		}
+
+		// Output tokens
+		printResult(tokens)
+	},
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Get JWT token using saved app configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
+		if saveParams {
+			saveRequestParams(currentAppName)
+		}
+
+		// First, check if we have a valid stored token
+		storedToken, err := getStoredToken(currentAppName)
+		if err == nil && (introspect || appConfig.IntrospectCachedTokens) {
+			// Make sure the provider still considers the token active
+			result, introspectErr := introspectToken(cmd.Context(), appConfig, storedToken.AccessToken, "access_token")
+			if introspectErr != nil {
+				exitWithError("Error introspecting token", introspectErr)
 			}
+			if active, _ := result["active"].(bool); !active {
+				err = fmt.Errorf("token for app '%s' is no longer active", currentAppName)
+			}
+		}
+		if err == nil {
+			printResult(storedToken)
+			return
+		}
+
+		// Try to renew the access token with the stored refresh token
+		if appConfig.RefreshToken != "" {
+			if !jsonOutput {
+				fmt.Printf("ℹ️  No valid stored token found: %v\n", err)
+				fmt.Println("🔄 Refreshing token...")
+			}
+			tokens, err := refreshTokens(cmd.Context(), appConfig, appConfig.RefreshToken)
+			if err == nil {
+				persistTokens(currentAppName, tokens)
+				printResult(tokens)
+				return
+			}
+			if !isInvalidGrant(err) {
+				exitWithError("Error refreshing token", err)
+			}
+			if !jsonOutput {
+				fmt.Printf("ℹ️  Refresh token rejected: %v\n", err)
+				fmt.Println("🔄 Requesting new tokens...")
+			}
+		} else if !jsonOutput {
+			fmt.Printf("ℹ️  No valid stored token found: %v\n", err)
+			fmt.Println("🔄 Requesting new tokens...")
 		}
 
+		// Obtain new tokens
+		tokens, err := obtainTokens(cmd.Context(), appConfig, flowOptions(cmd, currentAppName, appConfig))
+		if err != nil {
+			exitWithError("Error during OAuth flow", err)
+		}
+
+		// Save tokens to configuration
+		persistTokens(currentAppName, tokens)
+
 		// Output tokens
-		if jsonPath != "" {
-			// Apply JSONPath filtering
-			result, err := applyJSONPath(tokens, jsonPath)
-			if err != nil {
-				if jsonOutput {
-					errorResp := map[string]string{"error": err.Error()}
-					json.NewEncoder(os.Stderr).Encode(errorResp)
-				} else {
-					fmt.Fprintf(os.Stderr, "❌ JSONPath error: %v\n", err)
-				}
-				os.Exit(1)
+		printResult(tokens)
+	},
+}
+
+var refreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Renew tokens using the stored refresh token",
+	Run: func(cmd *cobra.Command, args []string) {
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
+
+		if appConfig.RefreshToken == "" {
+			exitWithError("Error", fmt.Errorf("no refresh token stored for app '%s'", currentAppName))
+		}
+
+		tokens, err := refreshTokens(cmd.Context(), appConfig, appConfig.RefreshToken)
+		if err != nil {
+			exitWithError("Error refreshing token", err)
+		}
+
+		persistTokens(currentAppName, tokens)
+		printResult(tokens)
+	},
+}
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke an app's tokens at the provider and clear them locally",
+	Run: func(cmd *cobra.Command, args []string) {
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
+
+		// Revoke everything unless a specific token was requested
+		access := revokeAccess || revokeAll || !revokeRefresh
+		refresh := revokeRefresh || revokeAll || !revokeAccess
+
+		// Revoke the refresh token first, many providers also invalidate
+		// the access tokens issued with it. Each token is cleared locally as
+		// soon as it is revoked, so a later failure doesn't leave a dead
+		// token behind.
+		tokens := []struct {
+			value, hint, label string
+			selected, isAccess bool
+		}{
+			{appConfig.RefreshToken, "refresh_token", "Refresh token", refresh, false},
+			{appConfig.AccessToken, "access_token", "Access token", access, true},
+		}
+		revoked, failed := 0, 0
+		for _, token := range tokens {
+			if !token.selected || token.value == "" {
+				continue
 			}
+			if err := revokeToken(cmd.Context(), appConfig, token.value, token.hint); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Error revoking %s: %v\n", strings.ToLower(token.label), err)
+				failed++
+				continue
+			}
+			if err := clearStoredTokens(currentAppName, token.isAccess, !token.isAccess); err != nil {
+				exitWithError("Error saving config", err)
+			}
+			color.Green("✅ %s revoked and cleared locally", token.label)
+			revoked++
+		}
 
-			if jsonOutput {
-				json.NewEncoder(os.Stdout).Encode(result)
-			} else {
-				// For non-JSON output, try to format nicely
-				if str, ok := result.(string); ok {
-					fmt.Println(str)
+		if failed > 0 {
+			exitWithError("Error", fmt.Errorf("%d of %d tokens could not be revoked and were kept locally", failed, failed+revoked))
+		}
+		if revoked == 0 {
+			fmt.Printf("ℹ️  No tokens stored for app '%s'\n", currentAppName)
+		}
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke tokens, clear local state and optionally end the provider session",
+	Run: func(cmd *cobra.Command, args []string) {
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
+		if postLogoutURI != "" {
+			appConfig.PostLogoutRedirectURI = postLogoutURI
+		}
+
+		// Keep the ID token for the end session request before clearing it
+		idToken := appConfig.IdToken
+
+		// Revoke tokens at the provider, where supported
+		metadata, discoveryErr := discoverProvider(cmd.Context(), appConfig)
+		if discoveryErr != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Warning: %v; skipping token revocation\n", discoveryErr)
+		} else if metadata.RevocationEndpoint != "" {
+			tokens := []struct{ value, hint, label string }{
+				{appConfig.RefreshToken, "refresh_token", "Refresh token"},
+				{appConfig.AccessToken, "access_token", "Access token"},
+			}
+			for _, token := range tokens {
+				if token.value == "" {
+					continue
+				}
+				if err := revokeToken(cmd.Context(), appConfig, token.value, token.hint); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Warning: Failed to revoke %s: %v\n", strings.ToLower(token.label), err)
 				} else {
-					output, _ := json.MarshalIndent(result, "", "  ")
-					fmt.Println(string(output))
+					color.Green("✅ %s revoked", token.label)
 				}
 			}
-		} else if jsonOutput {
-			json.NewEncoder(os.Stdout).Encode(tokens)
 		} else {
-			output, _ := json.MarshalIndent(tokens, "", "  ")
-			fmt.Println(string(output))
+			fmt.Println("ℹ️  Provider has no revocation endpoint, skipping token revocation")
+		}
+
+		// Clear local state
+		if err := clearStoredTokens(currentAppName, true, true); err != nil {
+			exitWithError("Error saving config", err)
+		}
+		color.Green("✅ Local tokens cleared for app '%s'", currentAppName)
+
+		// End the session at the provider
+		if endSession && discoveryErr != nil {
+			fmt.Fprintln(os.Stderr, "⚠️  Warning: Skipping provider session logout because discovery failed")
+		} else if endSession {
+			fmt.Println("🌐 Ending provider session in the browser...")
+			oauth := NewOAuthFlow()
+			if err := oauth.StartLogout(cmd.Context(), appConfig, idToken, flowOptions(cmd, currentAppName, appConfig)); err != nil {
+				exitWithError("Error ending provider session", err)
+			}
+			color.Green("✅ Logged out of the provider session")
 		}
 	},
 }
 
-var tokenCmd = &cobra.Command{
-	Use:   "token",
-	Short: "Get JWT token using saved app configuration",
+var introspectCmd = &cobra.Command{
+	Use:   "introspect [token|-]",
+	Short: "Check a token's server-side state via the introspection endpoint",
+	Long: `Post a token to the provider's introspection endpoint (RFC 7662) and print
+the response. By default the app's stored access token is used (or its refresh
+token with --token-type-hint refresh_token); a token can also be passed as an
+argument or read from stdin with "-".`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		var appConfig AppConfig
-		var currentAppName string
-		var err error
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
 
-		// Determine which app config to use
-		if appName != "" {
-			// Use specified app
-			config, exists := getApp(appName)
-			if !exists {
-				if jsonOutput {
-					errorResp := map[string]string{"error": fmt.Sprintf("App '%s' not found.", appName)}
-					json.NewEncoder(os.Stderr).Encode(errorResp)
-				} else {
-					fmt.Fprintf(os.Stderr, "❌ Error: App '%s' not found.\n", appName)
+		var token string
+		if len(args) == 1 {
+			token = args[0]
+			if token == "-" {
+				input, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					exitWithError("Error reading token from stdin", err)
 				}
-				os.Exit(1)
+				token = strings.TrimSpace(string(input))
 			}
-			appConfig = config
-			currentAppName = appName
+		} else if tokenTypeHint == "refresh_token" {
+			token = appConfig.RefreshToken
 		} else {
-			// Use default app
-			defaultAppName := getDefaultApp()
-			if defaultAppName == "" {
-				if jsonOutput {
-					errorResp := map[string]string{"error": "No default app set. Use --app to specify an app or run 'oauth-util configure'."}
-					json.NewEncoder(os.Stderr).Encode(errorResp)
-				} else {
-					fmt.Fprintf(os.Stderr, "❌ Error: No default app set. Use --app to specify an app or run 'oauth-util configure'.\n")
-				}
-				os.Exit(1)
+			token = appConfig.AccessToken
+		}
+		if token == "" {
+			exitWithError("Error", fmt.Errorf("no token stored for app '%s'", currentAppName))
+		}
+
+		result, err := introspectToken(cmd.Context(), appConfig, token, tokenTypeHint)
+		if err != nil {
+			exitWithError("Error introspecting token", err)
+		}
+
+		printResult(result)
+	},
+}
+
+var exchangeCmd = &cobra.Command{
+	Use:   "exchange",
+	Short: "Exchange another app's token for a new one via token exchange",
+	Long: `Perform an OAuth 2.0 Token Exchange (RFC 8693) with the app's client. The
+subject token is taken from another configured app's stored tokens (refreshed
+if needed), or read from stdin with --subject-token-from -. Results are cached
+on the app until they expire; use --no-cache to always ask the provider.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
+		if exchangeScope != "" {
+			appConfig.Scope = exchangeScope
+		}
+		if subjectTokenFrom == "" {
+			exitWithError("Error", fmt.Errorf("--subject-token-from is required (an app name, or - for stdin)"))
+		}
+
+		subjectType, err := tokenTypeURN(subjectTokenType)
+		if err != nil {
+			exitWithError("Error", err)
+		}
+		request := ExchangeRequest{
+			SubjectTokenType: subjectType,
+			Audience:         appConfig.Audience,
+			Scope:            appConfig.Scope,
+		}
+		if requestedTokenType != "" {
+			if request.RequestedTokenType, err = tokenTypeURN(requestedTokenType); err != nil {
+				exitWithError("Error", err)
 			}
-			config, exists := getApp(defaultAppName)
-			if !exists {
-				if jsonOutput {
-					errorResp := map[string]string{"error": "Default app not found. Run 'oauth-util configure' to set up apps."}
-					json.NewEncoder(os.Stderr).Encode(errorResp)
-				} else {
-					fmt.Fprintf(os.Stderr, "❌ Error: Default app not found. Run 'oauth-util configure' to set up apps.\n")
-				}
-				os.Exit(1)
+		}
+		if request.SubjectToken, err = subjectToken(cmd.Context(), subjectTokenFrom, subjectTokenType); err != nil {
+			exitWithError("Error reading subject token", err)
+		}
+
+		key := request.cacheKey(subjectTokenFrom, appConfig.TokenParams)
+		if !noCache {
+			if cached, ok := getExchangedToken(currentAppName, key, request.SubjectToken); ok {
+				printResult(cached)
+				return
 			}
-			appConfig = config
-			currentAppName = defaultAppName
 		}
 
-		// First, check if we have a valid stored token
-		if storedToken, err := getStoredToken(currentAppName); err == nil {
-			if jsonPath != "" {
-				// Apply JSONPath filtering
-				result, err := applyJSONPath(storedToken, jsonPath)
-				if err != nil {
-					if jsonOutput {
-						errorResp := map[string]string{"error": err.Error()}
-						json.NewEncoder(os.Stderr).Encode(errorResp)
-					} else {
-						fmt.Fprintf(os.Stderr, "❌ JSONPath error: %v\n", err)
-					}
-					os.Exit(1)
-				}
+		if !jsonOutput {
+			fmt.Println("🔄 Exchanging token...")
+		}
+		tokens, err := exchangeToken(cmd.Context(), appConfig, request)
+		if err != nil {
+			exitWithError("Error exchanging token", err)
+		}
 
-				if jsonOutput {
-					json.NewEncoder(os.Stdout).Encode(result)
-				} else {
-					// For non-JSON output, try to format nicely
-					if str, ok := result.(string); ok {
-						fmt.Println(str)
-					} else {
-						output, _ := json.MarshalIndent(result, "", "  ")
-						fmt.Println(string(output))
-					}
-				}
-			} else if jsonOutput {
-				json.NewEncoder(os.Stdout).Encode(storedToken)
-			} else {
-				output, _ := json.MarshalIndent(storedToken, "", "  ")
-				fmt.Println(string(output))
+		// Only cache results with a known lifetime
+		if tokens.ExpiresIn > 0 {
+			if err := saveExchangedToken(currentAppName, key, subjectTokenFrom, request.SubjectToken, tokens); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Warning: Failed to cache exchanged token: %v\n", err)
 			}
-			return
-		} else if !jsonOutput {
-			fmt.Printf("ℹ️  No valid stored token found: %v\n", err)
-			fmt.Println("🔄 Starting new OAuth flow...")
 		}
 
-		// Start OAuth flow
-		oauth := NewOAuthFlow()
-		tokens, err := oauth.StartFlow(appConfig, port)
+		printResult(tokens)
+	},
+}
+
+// subjectToken returns the subject token for an exchange: the token of the
+// given type stored for another app, or stdin when source is "-"
+func subjectToken(ctx context.Context, source, tokenType string) (string, error) {
+	if source == "-" {
+		input, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			if jsonOutput {
-				errorResp := map[string]string{"error": err.Error()}
-				json.NewEncoder(os.Stderr).Encode(errorResp)
-			} else {
-				fmt.Fprintf(os.Stderr, "❌ Error during OAuth flow: %v\n", err)
-			}
-			os.Exit(1)
+			return "", err
+		}
+		token := strings.TrimSpace(string(input))
+		if token == "" {
+			return "", fmt.Errorf("no token on stdin")
 		}
+		return token, nil
+	}
 
-		// Save tokens to configuration
-		if err := saveTokensToApp(currentAppName, tokens); err != nil {
-			if jsonOutput {
-				errorResp := map[string]string{"error": fmt.Sprintf("Failed to save tokens: %v", err)}
-				json.NewEncoder(os.Stderr).Encode(errorResp)
-			} else {
-				fmt.Fprintf(os.Stderr, "⚠️  Warning: Failed to save tokens: %v\n", err)
-			}
-		} else if !jsonOutput {
-			color.Green("✅ Tokens saved to configuration for app '%s'", currentAppName)
+	sourceApp, exists := getApp(source)
+	if !exists {
+		return "", fmt.Errorf("app '%s' not found", source)
+	}
+
+	var token string
+	switch strings.ToLower(tokenType) {
+	case "refresh_token":
+		token = sourceApp.RefreshToken
+	case "id_token":
+		tokens, err := currentTokens(ctx, source, sourceApp)
+		if err != nil {
+			return "", err
+		}
+		token = tokens.IdToken
+	default:
+		tokens, err := currentTokens(ctx, source, sourceApp)
+		if err != nil {
+			return "", err
 		}
+		token = tokens.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("no %s stored for app '%s'", tokenType, source)
+	}
+	return token, nil
+}
 
-		// Output tokens
-		if jsonPath != "" {
-			// Apply JSONPath filtering
-			result, err := applyJSONPath(tokens, jsonPath)
-			if err != nil {
-				if jsonOutput {
-					errorResp := map[string]string{"error": err.Error()}
-					json.NewEncoder(os.Stderr).Encode(errorResp)
-				} else {
-					fmt.Fprintf(os.Stderr, "❌ JSONPath error: %v\n", err)
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the profile of the logged in user from the userinfo endpoint",
+	Run: func(cmd *cobra.Command, args []string) {
+		currentAppName, appConfig := resolveApp()
+		applyFlagOverrides(&appConfig)
+
+		tokens, err := currentTokens(cmd.Context(), currentAppName, appConfig)
+		if err != nil {
+			exitWithError("Error", err)
+		}
+
+		profile, err := fetchUserInfo(cmd.Context(), appConfig, tokens.AccessToken, tokens.IdToken)
+		if err != nil {
+			exitWithError("Error fetching user info", err)
+		}
+
+		printResult(profile)
+	},
+}
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode [token|-]",
+	Short: "Decode a JWT and show its header and claims",
+	Long: `Decode the header and claims of a JWT. The token can be passed as an
+argument, read from stdin with "-", or taken from an app's stored tokens
+(the ID token by default, or the access token with --access).`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var token string
+		var appConfig AppConfig
+		var haveApp bool
+
+		if len(args) == 1 {
+			token = args[0]
+			if token == "-" {
+				input, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					exitWithError("Error reading token from stdin", err)
 				}
-				os.Exit(1)
+				token = strings.TrimSpace(string(input))
+			}
+		} else {
+			var currentAppName string
+			currentAppName, appConfig = resolveApp()
+			haveApp = true
+			token = appConfig.IdToken
+			if decodeAccess || token == "" {
+				token = appConfig.AccessToken
+			}
+			if token == "" {
+				exitWithError("Error", fmt.Errorf("no token stored for app '%s'", currentAppName))
 			}
+		}
 
-			if jsonOutput {
-				json.NewEncoder(os.Stdout).Encode(result)
+		jwt, err := parseJWT(token)
+		if err != nil {
+			exitWithError("Error decoding token", err)
+		}
+
+		decoded := DecodedJWT{
+			Header: jwt.Header,
+			Claims: jwt.Claims,
+		}
+
+		// Optionally verify the signature
+		if decodeJWKSFile != "" || decodeVerify {
+			if decodeJWKSFile != "" {
+				jwks, err := readJWKSFile(decodeJWKSFile)
+				if err == nil {
+					err = jwt.verifyWithJWKS(jwks)
+				}
+				if err != nil {
+					exitWithError("Signature verification failed", err)
+				}
 			} else {
-				// For non-JSON output, try to format nicely
-				if str, ok := result.(string); ok {
-					fmt.Println(str)
-				} else {
-					output, _ := json.MarshalIndent(result, "", "  ")
-					fmt.Println(string(output))
+				if !haveApp {
+					_, appConfig = resolveApp()
+				}
+				metadata, err := discoverProvider(cmd.Context(), appConfig)
+				if err == nil {
+					err = verifyWithProviderJWKS(cmd.Context(), appConfig, metadata, jwt)
+				}
+				if err != nil {
+					exitWithError("Signature verification failed", err)
 				}
 			}
-		} else if jsonOutput {
-			json.NewEncoder(os.Stdout).Encode(tokens)
-		} else {
-			output, _ := json.MarshalIndent(tokens, "", "  ")
-			fmt.Println(string(output))
+			verified := true
+			decoded.Verified = &verified
 		}
+
+		if jsonOutput || jsonPath != "" {
+			printResult(decoded)
+			return
+		}
+
+		printDecodedJWT(jwt, decoded.Verified != nil)
 	},
 }
 
@@ -332,23 +638,14 @@ var clearTokensCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		appName := args[0]
-		app, exists := getApp(appName)
+		_, exists := getApp(appName)
 		if !exists {
 			fmt.Fprintf(os.Stderr, "❌ Error: App '%s' not found.\n", appName)
 			os.Exit(1)
 		}
 
 		// Clear token information
-		app.AccessToken = ""
-		app.RefreshToken = ""
-		app.IdToken = ""
-		app.TokenType = ""
-		app.ExpiresAt = ""
-		app.ExpiresIn = 0
-
-		// Save updated config
-		config.Apps[appName] = app
-		if err := saveConfig(); err != nil {
+		if err := clearStoredTokens(appName, true, true); err != nil {
 			fmt.Fprintf(os.Stderr, "❌ Error saving config: %v\n", err)
 			os.Exit(1)
 		}
@@ -357,8 +654,286 @@ var clearTokensCmd = &cobra.Command{
 	},
 }
 
-// applyJSONPath applies JSONPath filtering to a token response
-func applyJSONPath(tokens *TokenResponse, jsonPathExpr string) (interface{}, error) {
+// resolveApp returns the app selected with --app, falling back to the default app
+func resolveApp() (string, AppConfig) {
+	if appName != "" {
+		app, exists := getApp(appName)
+		if !exists {
+			exitWithError("Error", fmt.Errorf("App '%s' not found.", appName))
+		}
+		return appName, app
+	}
+
+	defaultAppName := getDefaultApp()
+	if defaultAppName == "" {
+		exitWithError("Error", fmt.Errorf("No default app set. Use --app to specify an app or run 'oauth-util configure'."))
+	}
+	app, exists := getApp(defaultAppName)
+	if !exists {
+		exitWithError("Error", fmt.Errorf("Default app not found. Run 'oauth-util configure' to set up apps."))
+	}
+	return defaultAppName, app
+}
+
+// applyFlagOverrides applies command line overrides to an app configuration
+// for the current invocation only; overrides are never persisted
+func applyFlagOverrides(appConfig *AppConfig) {
+	if pkceMethod != "" {
+		appConfig.PKCEMethod = pkceMethod
+	}
+
+	if authMethod != "" {
+		appConfig.TokenEndpointAuthMethod = authMethod
+	}
+
+	// Client secret: --client-secret takes precedence over the environment,
+	// which takes precedence over the saved configuration. The environment
+	// only applies to confidential apps so exporting it for one app doesn't
+	// turn public and private_key_jwt apps into client_secret_basic ones.
+	if clientSecret != "" {
+		appConfig.ClientSecret = clientSecret
+		appConfig.ClientSecretRef = ""
+	} else if secret, ok := os.LookupEnv(clientSecretEnv); ok && secret != "" && usesClientSecret(*appConfig) {
+		appConfig.ClientSecret = secret
+		appConfig.ClientSecretRef = ""
+	}
+	if grantType != "" {
+		appConfig.GrantType = grantType
+	}
+	if validateID {
+		appConfig.ValidateIDToken = true
+	}
+	if redirectURI != "" {
+		appConfig.RedirectURI = redirectURI
+	}
+	if callbackTLS {
+		appConfig.CallbackTLS = true
+	}
+	if responseMode != "" {
+		appConfig.ResponseMode = responseMode
+	}
+	if username != "" {
+		appConfig.Username = username
+	}
+	if waitTimeout > 0 {
+		appConfig.Timeout = waitTimeout.String()
+	}
+	if requestTimeout > 0 {
+		appConfig.HTTPTimeout = requestTimeout.String()
+	}
+	applyRequestParamOverrides(appConfig)
+}
+
+// applyRequestParamOverrides applies the authorization and token request
+// parameter flags to an app configuration
+func applyRequestParamOverrides(appConfig *AppConfig) {
+	overrides := []struct {
+		key    string
+		value  string
+		target *string
+	}{
+		{"audience", audience, &appConfig.Audience},
+		{"prompt", authPrompt, &appConfig.Prompt},
+		{"login_hint", loginHint, &appConfig.LoginHint},
+		{"acr_values", acrValues, &appConfig.ACRValues},
+		{"max_age", maxAge, &appConfig.MaxAge},
+		{"ui_locales", uiLocales, &appConfig.UILocales},
+	}
+	for _, override := range overrides {
+		if slices.Contains(unsetParams, override.key) {
+			*override.target = ""
+		}
+		if override.value != "" {
+			*override.target = override.value
+		}
+	}
+
+	// Removing parameters also works on copies of the maps
+	if len(unsetParams) > 0 {
+		appConfig.AuthParams = mergeParams(appConfig.AuthParams, nil)
+		appConfig.TokenParams = mergeParams(appConfig.TokenParams, nil)
+		for _, key := range unsetParams {
+			delete(appConfig.AuthParams, key)
+			delete(appConfig.TokenParams, key)
+		}
+	}
+
+	// Merge into copies so the saved app's maps aren't modified
+	if len(authParams) > 0 {
+		params, err := parseKeyValues(authParams)
+		if err != nil {
+			exitWithError("Error", err)
+		}
+		appConfig.AuthParams = mergeParams(appConfig.AuthParams, params)
+	}
+	if len(tokenParams) > 0 {
+		params, err := parseKeyValues(tokenParams)
+		if err != nil {
+			exitWithError("Error", err)
+		}
+		appConfig.TokenParams = mergeParams(appConfig.TokenParams, params)
+	}
+}
+
+// saveRequestParams persists the request parameter flags to a saved app
+func saveRequestParams(name string) {
+	if name == "" {
+		exitWithError("Error", fmt.Errorf("--save-params requires a saved app; use --app or run 'oauth-util configure'"))
+	}
+	app, exists := getApp(name)
+	if !exists {
+		exitWithError("Error", fmt.Errorf("app '%s' not found", name))
+	}
+	applyRequestParamOverrides(&app)
+	saveApp(name, app)
+	if !jsonOutput {
+		color.Green("✅ Request parameters saved for app '%s'", name)
+	}
+}
+
+// callbackPort returns the callback port list for a flow: an explicit --port
+// wins over the app's saved ports, which win over the --port default
+func callbackPort(cmd *cobra.Command, appConfig AppConfig) string {
+	if cmd.Flags().Changed("port") || appConfig.Port == "" {
+		return port
+	}
+	return appConfig.Port
+}
+
+// flowOptions collects the interactive flow settings for an invocation
+func flowOptions(cmd *cobra.Command, name string, appConfig AppConfig) FlowOptions {
+	timeout, err := flowTimeout(appConfig)
+	if err != nil {
+		exitWithError("Error", err)
+	}
+	return FlowOptions{
+		AppName:       name,
+		Port:          callbackPort(cmd, appConfig),
+		NoBrowser:     noBrowser,
+		Timeout:       timeout,
+		PasswordStdin: passwordStdin,
+	}
+}
+
+// currentTokens returns the app's stored tokens, renewing them with the
+// refresh token if they have expired. It never starts an interactive flow.
+func currentTokens(ctx context.Context, appName string, appConfig AppConfig) (*TokenResponse, error) {
+	storedToken, err := getStoredToken(appName)
+	if err == nil {
+		return storedToken, nil
+	}
+	if appConfig.RefreshToken == "" {
+		return nil, fmt.Errorf("%v; run 'oauth-util login --app %s'", err, appName)
+	}
+
+	tokens, err := refreshTokens(ctx, appConfig, appConfig.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %v; run 'oauth-util login --app %s'", err, appName)
+	}
+	if err := saveTokensToApp(appName, tokens); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Warning: Failed to save tokens: %v\n", err)
+	}
+	return tokens, nil
+}
+
+// exitWithError reports an error on stderr, as JSON when --json is set, and exits
+func exitWithError(label string, err error) {
+	// Report an interrupt as such rather than as whatever it cut short
+	if code := interruptExitCode(); code != 0 {
+		if jsonOutput {
+			json.NewEncoder(os.Stderr).Encode(map[string]string{"error": "interrupted"})
+		} else {
+			fmt.Fprintln(os.Stderr, "\n⚠️  Interrupted")
+		}
+		os.Exit(code)
+	}
+
+	if jsonOutput {
+		errorResp := map[string]string{"error": err.Error()}
+		json.NewEncoder(os.Stderr).Encode(errorResp)
+	} else {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", label, err)
+	}
+	os.Exit(1)
+}
+
+// persistTokens saves tokens to an app, warning if the config can't be written
+func persistTokens(appName string, tokens *TokenResponse) {
+	if err := saveTokensToApp(appName, tokens); err != nil {
+		if jsonOutput {
+			errorResp := map[string]string{"error": fmt.Sprintf("Failed to save tokens: %v", err)}
+			json.NewEncoder(os.Stderr).Encode(errorResp)
+		} else {
+			fmt.Fprintf(os.Stderr, "⚠️  Warning: Failed to save tokens: %v\n", err)
+		}
+	} else if !jsonOutput {
+		color.Green("✅ Tokens saved to configuration for app '%s'", appName)
+	}
+}
+
+// printResult writes any JSON-serialisable value to stdout, honouring --json and --jsonpath
+func printResult(data interface{}) {
+	if jsonPath != "" {
+		// Apply JSONPath filtering
+		result, err := applyJSONPath(data, jsonPath)
+		if err != nil {
+			exitWithError("JSONPath error", err)
+		}
+
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(result)
+		} else {
+			// For non-JSON output, try to format nicely
+			if str, ok := result.(string); ok {
+				fmt.Println(str)
+			} else {
+				output, _ := json.MarshalIndent(result, "", "  ")
+				fmt.Println(string(output))
+			}
+		}
+	} else if jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(data)
+	} else {
+		output, _ := json.MarshalIndent(data, "", "  ")
+		fmt.Println(string(output))
+	}
+}
+
+// printDecodedJWT pretty-prints a decoded JWT with human-readable timestamps
+func printDecodedJWT(jwt *JWT, verified bool) {
+	header, _ := json.MarshalIndent(jwt.Header, "", "  ")
+	claims, _ := json.MarshalIndent(jwt.Claims, "", "  ")
+
+	color.Cyan("Header:")
+	fmt.Println(string(header))
+	color.Cyan("Payload:")
+	fmt.Println(string(claims))
+
+	fmt.Println()
+	if exp, ok := jwt.ClaimTime("exp"); ok {
+		remaining := time.Until(exp).Round(time.Second)
+		if remaining > 0 {
+			fmt.Printf("  Expires:    %s (in %s)\n", exp.Format("2006-01-02 15:04:05"), remaining)
+		} else {
+			fmt.Printf("  Expired:    %s (%s ago)\n", exp.Format("2006-01-02 15:04:05"), -remaining)
+		}
+	}
+	if iat, ok := jwt.ClaimTime("iat"); ok {
+		fmt.Printf("  Issued At:  %s (%s ago)\n", iat.Format("2006-01-02 15:04:05"), time.Since(iat).Round(time.Second))
+	}
+	if nbf, ok := jwt.ClaimTime("nbf"); ok {
+		fmt.Printf("  Not Before: %s\n", nbf.Format("2006-01-02 15:04:05"))
+	}
+
+	if verified {
+		fmt.Println("  Signature:  ✅ Verified")
+	} else {
+		fmt.Println("  Signature:  ⚠️  Not verified (use --verify or --jwks)")
+	}
+}
+
+// applyJSONPath applies JSONPath filtering to a token response or other JSON data
+func applyJSONPath(tokens interface{}, jsonPathExpr string) (interface{}, error) {
 	// Convert tokens to JSON
 	tokenJSON, err := json.Marshal(tokens)
 	if err != nil {
@@ -395,13 +970,130 @@ func init() {
 	loginCmd.Flags().StringVarP(&clientID, "client-id", "c", "", "OAuth2 Client ID")
 	loginCmd.Flags().StringVarP(&domain, "domain", "d", "", "OAuth2 Domain (full URL)")
 	loginCmd.Flags().StringVarP(&scope, "scope", "s", "openid email profile", "OAuth2 Scope")
-	loginCmd.Flags().StringVarP(&port, "port", "p", "3000", "Local server port")
+	loginCmd.Flags().StringVarP(&port, "port", "p", "3000", "Local server port; comma-separated fallbacks or ranges (e.g. 8400-8402), 0 for any free port")
 	loginCmd.Flags().StringVarP(&appName, "app", "a", "", "Use saved app configuration")
 	loginCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
+	loginCmd.Flags().StringVar(&pkceMethod, "pkce", "", "PKCE code challenge method (S256, plain or disabled)")
+	loginCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	loginCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	loginCmd.Flags().BoolVar(&validateID, "validate-id-token", false, "Validate the ID token signature and claims against the provider JWKS")
+	loginCmd.Flags().StringVar(&grantType, "grant-type", "", "Grant type (authorization_code, device_code, client_credentials or password)")
+	loginCmd.Flags().StringVar(&redirectURI, "redirect-uri", "", "Loopback redirect URI (default: http://localhost:<port>/)")
+	loginCmd.Flags().BoolVar(&noBrowser, "no-browser", false, "Print the authorization URL and paste the redirect URL (or just the code) back instead of opening a browser")
+	loginCmd.Flags().BoolVar(&callbackTLS, "https", false, "Serve the callback over HTTPS (redirect URI https://localhost:<port>/)")
+	loginCmd.Flags().StringVar(&responseMode, "response-mode", "", "How the provider returns the authorization response (query, fragment or form_post)")
+	loginCmd.Flags().StringVar(&username, "username", "", "Username for the password grant")
+	loginCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password grant's password from stdin (or set "+passwordEnv+")")
+	loginCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "How long to wait for the browser flow or device approval to complete (default: app setting, otherwise 5m)")
+	loginCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+	loginCmd.Flags().StringVar(&audience, "audience", "", "API audience to request (e.g. for Auth0)")
+	loginCmd.Flags().StringVar(&authPrompt, "prompt", "", "OIDC prompt parameter (none, login, consent or select_account)")
+	loginCmd.Flags().StringVar(&loginHint, "login-hint", "", "Hint about the user to log in, e.g. an email address")
+	loginCmd.Flags().StringVar(&acrValues, "acr-values", "", "Requested authentication context class references (e.g. for step-up MFA)")
+	loginCmd.Flags().StringVar(&maxAge, "max-age", "", "Maximum authentication age in seconds before the user must re-authenticate")
+	loginCmd.Flags().StringVar(&uiLocales, "ui-locales", "", "Preferred languages for the login page, e.g. \"de en\"")
+	loginCmd.Flags().StringArrayVar(&authParams, "auth-param", nil, "Extra authorization request parameter as key=value (repeatable)")
+	loginCmd.Flags().StringArrayVar(&tokenParams, "token-param", nil, "Extra token request parameter as key=value (repeatable)")
+	loginCmd.Flags().StringArrayVar(&unsetParams, "unset-param", nil, "Remove a saved request parameter, e.g. audience or a --auth-param/--token-param key (repeatable)")
+	loginCmd.Flags().BoolVar(&saveParams, "save-params", false, "Save the request parameter flags to the app")
 
 	// Token command flags
-	tokenCmd.Flags().StringVarP(&port, "port", "p", "3000", "Local server port")
+	tokenCmd.Flags().StringVarP(&port, "port", "p", "3000", "Local server port; comma-separated fallbacks or ranges (e.g. 8400-8402), 0 for any free port")
 	tokenCmd.Flags().StringVarP(&appName, "app", "a", "", "Use specific app (defaults to default app)")
 	tokenCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
 	tokenCmd.Flags().StringVar(&jsonPath, "jsonpath", "", "JSONPath expression to filter token response")
+	tokenCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	tokenCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	tokenCmd.Flags().BoolVar(&introspect, "introspect", false, "Check a cached token with the introspection endpoint before returning it")
+	tokenCmd.Flags().BoolVar(&validateID, "validate-id-token", false, "Validate the ID token signature and claims against the provider JWKS")
+	tokenCmd.Flags().StringVar(&redirectURI, "redirect-uri", "", "Loopback redirect URI (default: http://localhost:<port>/)")
+	tokenCmd.Flags().BoolVar(&noBrowser, "no-browser", false, "Print the authorization URL and paste the redirect URL (or just the code) back instead of opening a browser")
+	tokenCmd.Flags().BoolVar(&callbackTLS, "https", false, "Serve the callback over HTTPS (redirect URI https://localhost:<port>/)")
+	tokenCmd.Flags().StringVar(&responseMode, "response-mode", "", "How the provider returns the authorization response (query, fragment or form_post)")
+	tokenCmd.Flags().StringVar(&username, "username", "", "Username for the password grant")
+	tokenCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password grant's password from stdin (or set "+passwordEnv+")")
+	tokenCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "How long to wait for the browser flow or device approval to complete (default: app setting, otherwise 5m)")
+	tokenCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+	tokenCmd.Flags().StringVar(&audience, "audience", "", "API audience to request (e.g. for Auth0)")
+	tokenCmd.Flags().StringVar(&authPrompt, "prompt", "", "OIDC prompt parameter (none, login, consent or select_account)")
+	tokenCmd.Flags().StringVar(&loginHint, "login-hint", "", "Hint about the user to log in, e.g. an email address")
+	tokenCmd.Flags().StringVar(&acrValues, "acr-values", "", "Requested authentication context class references (e.g. for step-up MFA)")
+	tokenCmd.Flags().StringVar(&maxAge, "max-age", "", "Maximum authentication age in seconds before the user must re-authenticate")
+	tokenCmd.Flags().StringVar(&uiLocales, "ui-locales", "", "Preferred languages for the login page, e.g. \"de en\"")
+	tokenCmd.Flags().StringArrayVar(&authParams, "auth-param", nil, "Extra authorization request parameter as key=value (repeatable)")
+	tokenCmd.Flags().StringArrayVar(&tokenParams, "token-param", nil, "Extra token request parameter as key=value (repeatable)")
+	tokenCmd.Flags().StringArrayVar(&unsetParams, "unset-param", nil, "Remove a saved request parameter, e.g. audience or a --auth-param/--token-param key (repeatable)")
+	tokenCmd.Flags().BoolVar(&saveParams, "save-params", false, "Save the request parameter flags to the app")
+
+	// Refresh command flags
+	refreshCmd.Flags().StringVarP(&appName, "app", "a", "", "Use specific app (defaults to default app)")
+	refreshCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
+	refreshCmd.Flags().StringVar(&jsonPath, "jsonpath", "", "JSONPath expression to filter token response")
+	refreshCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	refreshCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	refreshCmd.Flags().BoolVar(&validateID, "validate-id-token", false, "Validate the ID token signature and claims against the provider JWKS")
+	refreshCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+	refreshCmd.Flags().StringVar(&audience, "audience", "", "API audience to request (default: app setting)")
+	refreshCmd.Flags().StringArrayVar(&tokenParams, "token-param", nil, "Extra token request parameter as key=value (repeatable)")
+
+	// Decode command flags
+	decodeCmd.Flags().StringVarP(&appName, "app", "a", "", "Decode a token stored for this app (defaults to default app)")
+	decodeCmd.Flags().BoolVar(&decodeAccess, "access", false, "Decode the stored access token instead of the ID token")
+	decodeCmd.Flags().BoolVar(&decodeVerify, "verify", false, "Verify the signature against the app's discovered JWKS")
+	decodeCmd.Flags().StringVar(&decodeJWKSFile, "jwks", "", "Verify the signature against a local JWKS (or JWK) file")
+	decodeCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
+	decodeCmd.Flags().StringVar(&jsonPath, "jsonpath", "", "JSONPath expression to filter the decoded token")
+	decodeCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+
+	// Revoke command flags
+	revokeCmd.Flags().StringVarP(&appName, "app", "a", "", "Use specific app (defaults to default app)")
+	revokeCmd.Flags().BoolVar(&revokeAccess, "access", false, "Revoke only the access token")
+	revokeCmd.Flags().BoolVar(&revokeRefresh, "refresh", false, "Revoke only the refresh token")
+	revokeCmd.Flags().BoolVar(&revokeAll, "all", false, "Revoke both the access and refresh tokens (default)")
+	revokeCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	revokeCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	revokeCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+	revokeCmd.MarkFlagsMutuallyExclusive("access", "refresh", "all")
+
+	// Introspect command flags
+	introspectCmd.Flags().StringVarP(&appName, "app", "a", "", "Use specific app (defaults to default app)")
+	introspectCmd.Flags().StringVar(&tokenTypeHint, "token-type-hint", "", "Token type hint (access_token or refresh_token)")
+	introspectCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
+	introspectCmd.Flags().StringVar(&jsonPath, "jsonpath", "", "JSONPath expression to filter the introspection response")
+	introspectCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	introspectCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	introspectCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+
+	// Whoami command flags
+	whoamiCmd.Flags().StringVarP(&appName, "app", "a", "", "Use specific app (defaults to default app)")
+	whoamiCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
+	whoamiCmd.Flags().StringVar(&jsonPath, "jsonpath", "", "JSONPath expression to filter the profile")
+	whoamiCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	whoamiCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	whoamiCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+
+	// Exchange command flags
+	exchangeCmd.Flags().StringVarP(&appName, "app", "a", "", "App whose client performs the exchange (defaults to default app)")
+	exchangeCmd.Flags().StringVar(&subjectTokenFrom, "subject-token-from", "", "App whose stored token is exchanged, or - to read the token from stdin")
+	exchangeCmd.Flags().StringVar(&subjectTokenType, "subject-token-type", "access_token", "Subject token type (access_token, refresh_token, id_token, jwt or a URN)")
+	exchangeCmd.Flags().StringVar(&requestedTokenType, "requested-token-type", "", "Token type to request (access_token, refresh_token, id_token, jwt or a URN)")
+	exchangeCmd.Flags().StringVar(&audience, "audience", "", "Audience of the requested token (default: app setting)")
+	exchangeCmd.Flags().StringVarP(&exchangeScope, "scope", "s", "", "Scope of the requested token (default: app setting)")
+	exchangeCmd.Flags().StringArrayVar(&tokenParams, "token-param", nil, "Extra token request parameter as key=value, e.g. resource=... (repeatable)")
+	exchangeCmd.Flags().BoolVar(&noCache, "no-cache", false, "Always exchange the token instead of using a cached result")
+	exchangeCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output only JSON data (for piping to jq)")
+	exchangeCmd.Flags().StringVar(&jsonPath, "jsonpath", "", "JSONPath expression to filter the token response")
+	exchangeCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	exchangeCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	exchangeCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
+
+	// Logout command flags
+	logoutCmd.Flags().StringVarP(&appName, "app", "a", "", "Use specific app (defaults to default app)")
+	logoutCmd.Flags().BoolVar(&endSession, "end-session", false, "Open the provider's end_session_endpoint to end the browser session")
+	logoutCmd.Flags().StringVarP(&port, "port", "p", "3000", "Local server port for the post-logout redirect; comma-separated fallbacks or ranges (e.g. 8400-8402), 0 for any free port")
+	logoutCmd.Flags().StringVar(&postLogoutURI, "post-logout-redirect-uri", "", "Post-logout redirect URI (default: http://localhost:<port>/logout)")
+	logoutCmd.Flags().StringVar(&clientSecret, "client-secret", "", "OAuth2 Client Secret (or set "+clientSecretEnv+")")
+	logoutCmd.Flags().StringVar(&authMethod, "auth-method", "", "Token endpoint auth method (client_secret_basic, client_secret_post, private_key_jwt or none)")
+	logoutCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "How long to wait for the browser flow to complete (default: app setting, otherwise 5m)")
+	logoutCmd.Flags().DurationVar(&requestTimeout, "http-timeout", 0, "Timeout for each request to the provider (default: app setting, otherwise 10s)")
 }
@@ -11,24 +11,94 @@ import (
 )
 
 type AppConfig struct {
-	ClientID     string `json:"client_id" mapstructure:"client_id"`
-	Domain       string `json:"domain" mapstructure:"domain"`
-	Scope        string `json:"scope" mapstructure:"scope"`
-	AccessToken  string `json:"access_token,omitempty" mapstructure:"access_token"`
-	IdToken      string `json:"id_token,omitempty" mapstructure:"id_token"`
-	RefreshToken string `json:"refresh_token,omitempty" mapstructure:"refresh_token"`
-	TokenType    string `json:"token_type,omitempty" mapstructure:"token_type"`
-	ExpiresIn    int    `json:"expires_in,omitempty" mapstructure:"expires_in"`
-	ExpiresAt    string `json:"expires_at,omitempty" mapstructure:"expires_at"`
+	ClientID                    string            `json:"client_id" mapstructure:"client_id"`
+	GrantType                   string            `json:"grant_type,omitempty" mapstructure:"grant_type"`
+	Username                    string            `json:"username,omitempty" mapstructure:"username"`
+	ClientSecret                string            `json:"client_secret,omitempty" mapstructure:"client_secret"`
+	ClientSecretRef             string            `json:"client_secret_ref,omitempty" mapstructure:"client_secret_ref"`
+	TokenEndpointAuthMethod     string            `json:"token_endpoint_auth_method,omitempty" mapstructure:"token_endpoint_auth_method"`
+	ClientAssertionKeyFile      string            `json:"client_assertion_key_file,omitempty" mapstructure:"client_assertion_key_file"`
+	ClientAssertionAlg          string            `json:"client_assertion_alg,omitempty" mapstructure:"client_assertion_alg"`
+	ClientAssertionKID          string            `json:"client_assertion_kid,omitempty" mapstructure:"client_assertion_kid"`
+	ClientAssertionAudience     string            `json:"client_assertion_audience,omitempty" mapstructure:"client_assertion_audience"`
+	ClientAssertionLifetime     string            `json:"client_assertion_lifetime,omitempty" mapstructure:"client_assertion_lifetime"`
+	Domain                      string            `json:"domain" mapstructure:"domain"`
+	Issuer                      string            `json:"issuer,omitempty" mapstructure:"issuer"`
+	AuthorizationEndpoint       string            `json:"authorization_endpoint,omitempty" mapstructure:"authorization_endpoint"`
+	TokenEndpoint               string            `json:"token_endpoint,omitempty" mapstructure:"token_endpoint"`
+	UserinfoEndpoint            string            `json:"userinfo_endpoint,omitempty" mapstructure:"userinfo_endpoint"`
+	RevocationEndpoint          string            `json:"revocation_endpoint,omitempty" mapstructure:"revocation_endpoint"`
+	IntrospectionEndpoint       string            `json:"introspection_endpoint,omitempty" mapstructure:"introspection_endpoint"`
+	JWKSURI                     string            `json:"jwks_uri,omitempty" mapstructure:"jwks_uri"`
+	EndSessionEndpoint          string            `json:"end_session_endpoint,omitempty" mapstructure:"end_session_endpoint"`
+	PostLogoutRedirectURI       string            `json:"post_logout_redirect_uri,omitempty" mapstructure:"post_logout_redirect_uri"`
+	DeviceAuthorizationEndpoint string            `json:"device_authorization_endpoint,omitempty" mapstructure:"device_authorization_endpoint"`
+	DiscoveryTTL                string            `json:"discovery_ttl,omitempty" mapstructure:"discovery_ttl"`
+	Timeout                     string            `json:"timeout,omitempty" mapstructure:"timeout"`
+	HTTPTimeout                 string            `json:"http_timeout,omitempty" mapstructure:"http_timeout"`
+	Scope                       string            `json:"scope" mapstructure:"scope"`
+	Audience                    string            `json:"audience,omitempty" mapstructure:"audience"`
+	Prompt                      string            `json:"prompt,omitempty" mapstructure:"prompt"`
+	LoginHint                   string            `json:"login_hint,omitempty" mapstructure:"login_hint"`
+	ACRValues                   string            `json:"acr_values,omitempty" mapstructure:"acr_values"`
+	MaxAge                      string            `json:"max_age,omitempty" mapstructure:"max_age"`
+	UILocales                   string            `json:"ui_locales,omitempty" mapstructure:"ui_locales"`
+	AuthParams                  map[string]string `json:"auth_params,omitempty" mapstructure:"auth_params"`
+	TokenParams                 map[string]string `json:"token_params,omitempty" mapstructure:"token_params"`
+	PKCEMethod                  string            `json:"pkce_method,omitempty" mapstructure:"pkce_method"`
+	ResponseMode                string            `json:"response_mode,omitempty" mapstructure:"response_mode"`
+	Port                        string            `json:"port,omitempty" mapstructure:"port"`
+	RedirectURI                 string            `json:"redirect_uri,omitempty" mapstructure:"redirect_uri"`
+	CallbackTLS                 bool              `json:"callback_tls,omitempty" mapstructure:"callback_tls"`
+	CallbackCertFile            string            `json:"callback_cert_file,omitempty" mapstructure:"callback_cert_file"`
+	CallbackKeyFile             string            `json:"callback_key_file,omitempty" mapstructure:"callback_key_file"`
+	SuccessTemplate             string            `json:"success_template,omitempty" mapstructure:"success_template"`
+	ErrorTemplate               string            `json:"error_template,omitempty" mapstructure:"error_template"`
+	AutoClosePage               bool              `json:"auto_close_page,omitempty" mapstructure:"auto_close_page"`
+	ValidateIDToken             bool              `json:"validate_id_token,omitempty" mapstructure:"validate_id_token"`
+	ClockSkew                   string            `json:"clock_skew,omitempty" mapstructure:"clock_skew"`
+	IntrospectCachedTokens      bool              `json:"introspect_cached_tokens,omitempty" mapstructure:"introspect_cached_tokens"`
+	AccessToken                 string            `json:"access_token,omitempty" mapstructure:"access_token"`
+	IdToken                     string            `json:"id_token,omitempty" mapstructure:"id_token"`
+	RefreshToken                string            `json:"refresh_token,omitempty" mapstructure:"refresh_token"`
+	TokenType                   string            `json:"token_type,omitempty" mapstructure:"token_type"`
+	ExpiresIn                   int               `json:"expires_in,omitempty" mapstructure:"expires_in"`
+	ExpiresAt                   string            `json:"expires_at,omitempty" mapstructure:"expires_at"`
+	ExchangedTokens             ExchangeCache     `json:"exchanged_tokens,omitempty" mapstructure:"exchanged_tokens"`
+}
+
+// ExchangeCache holds an app's cached token exchange results
+type ExchangeCache map[string]ExchangedToken
+
+// ExchangedToken is a cached token exchange result, keyed by a hash of the
+// exchange request
+type ExchangedToken struct {
+	Source           string `json:"source" mapstructure:"source"`
+	SubjectTokenHash string `json:"subject_token_hash" mapstructure:"subject_token_hash"`
+	AccessToken      string `json:"access_token" mapstructure:"access_token"`
+	IssuedTokenType  string `json:"issued_token_type,omitempty" mapstructure:"issued_token_type"`
+	TokenType        string `json:"token_type,omitempty" mapstructure:"token_type"`
+	ExpiresIn        int    `json:"expires_in,omitempty" mapstructure:"expires_in"`
+	ExpiresAt        string `json:"expires_at" mapstructure:"expires_at"`
 }
 
 type Config struct {
 	Apps       map[string]AppConfig `json:"apps" mapstructure:"apps"`
 	DefaultApp string               `json:"default_app" mapstructure:"default_app"`
+
+	// Callback pages shared by all apps; app settings take precedence
+	SuccessTemplate string `json:"success_template,omitempty" mapstructure:"success_template"`
+	ErrorTemplate   string `json:"error_template,omitempty" mapstructure:"error_template"`
+	AutoClosePage   bool   `json:"auto_close_page,omitempty" mapstructure:"auto_close_page"`
 }
 
 var config Config
 
+// dataDir returns the directory for oauth-util's cached files
+func dataDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "oauth-util")
+}
+
 func init() {
 	// Create config directory if it doesn't exist
 	configDir := filepath.Join(os.Getenv("HOME"), ".config")
@@ -142,8 +212,70 @@ func interactiveSetup() (string, AppConfig, error) {
 		return "", AppConfig{}, err
 	}
 
+	grantSelect := promptui.Select{
+		Label: "Grant type",
+		Items: []string{GrantAuthorizationCode, GrantDeviceCode, GrantClientCredentials, GrantPassword},
+	}
+	_, grantType, err := grantSelect.Run()
+	if err != nil {
+		return "", AppConfig{}, err
+	}
+
 	prompt = promptui.Prompt{
-		Label: "OAuth2 Domain (full URL, e.g., https://accounts.google.com)",
+		Label: "OAuth2 Client Secret (leave empty for public clients and private_key_jwt, or env:/file:/cmd: reference)",
+		Mask:  '*',
+	}
+	clientSecret, err := prompt.Run()
+	if err != nil {
+		return "", AppConfig{}, err
+	}
+
+	// Without a secret the client is either public or signs client assertions
+	authMethods := []string{AuthMethodSecretBasic, AuthMethodSecretPost}
+	if clientSecret == "" {
+		authMethods = []string{AuthMethodNone, AuthMethodPrivateKeyJWT}
+		if grantType == GrantClientCredentials {
+			authMethods = []string{AuthMethodPrivateKeyJWT}
+		}
+	}
+	authSelect := promptui.Select{
+		Label: "Token endpoint auth method",
+		Items: authMethods,
+	}
+	_, authMethod, err := authSelect.Run()
+	if err != nil {
+		return "", AppConfig{}, err
+	}
+	if authMethod == AuthMethodNone {
+		authMethod = ""
+	}
+
+	assertionKeyFile := ""
+	assertionKID := ""
+	if authMethod == AuthMethodPrivateKeyJWT {
+		prompt = promptui.Prompt{
+			Label: "Client assertion private key (PEM file)",
+			Validate: func(input string) error {
+				_, err := loadAssertionKey(input)
+				return err
+			},
+		}
+		assertionKeyFile, err = prompt.Run()
+		if err != nil {
+			return "", AppConfig{}, err
+		}
+
+		prompt = promptui.Prompt{
+			Label: "Client assertion key ID (kid, optional)",
+		}
+		assertionKID, err = prompt.Run()
+		if err != nil {
+			return "", AppConfig{}, err
+		}
+	}
+
+	prompt = promptui.Prompt{
+		Label: "OAuth2 Domain or Issuer URL (full URL, e.g., https://accounts.google.com)",
 		Validate: func(input string) error {
 			if input == "" {
 				return fmt.Errorf("domain is required")
@@ -164,11 +296,90 @@ func interactiveSetup() (string, AppConfig, error) {
 		Label:   "OAuth2 Scope (default: openid email profile)",
 		Default: "openid email profile",
 	}
+	if grantType == GrantClientCredentials {
+		prompt = promptui.Prompt{
+			Label: "OAuth2 Scope (optional)",
+		}
+	}
 	scope, err := prompt.Run()
 	if err != nil {
 		return "", AppConfig{}, err
 	}
 
+	username := ""
+	if grantType == GrantPassword {
+		prompt = promptui.Prompt{
+			Label: "Username (the password is asked for at login and never saved)",
+			Validate: func(input string) error {
+				if input == "" {
+					return fmt.Errorf("username is required for the password grant")
+				}
+				return nil
+			},
+		}
+		username, err = prompt.Run()
+		if err != nil {
+			return "", AppConfig{}, err
+		}
+	}
+
+	pkceMethod := ""
+	callbackPorts := ""
+	redirectURI := ""
+	if grantType == GrantAuthorizationCode {
+		prompt = promptui.Prompt{
+			Label:   "Callback port(s) (comma-separated fallbacks, 0 for any free port)",
+			Default: "3000",
+			Validate: func(input string) error {
+				_, err := parsePortList(input)
+				return err
+			},
+		}
+		callbackPorts, err = prompt.Run()
+		if err != nil {
+			return "", AppConfig{}, err
+		}
+		if callbackPorts == "3000" {
+			callbackPorts = ""
+		}
+
+		prompt = promptui.Prompt{
+			Label: "Redirect URI (optional, default http://localhost:<port>/)",
+			Validate: func(input string) error {
+				if input == "" {
+					return nil
+				}
+				_, err := parseLoopbackRedirect(input)
+				return err
+			},
+		}
+		redirectURI, err = prompt.Run()
+		if err != nil {
+			return "", AppConfig{}, err
+		}
+
+		pkceSelect := promptui.Select{
+			Label: "PKCE code challenge method",
+			Items: []string{PKCEMethodS256, PKCEMethodPlain, PKCEMethodDisabled},
+		}
+		_, pkceMethod, err = pkceSelect.Run()
+		if err != nil {
+			return "", AppConfig{}, err
+		}
+	}
+
+	validateIDToken := ""
+	if grantType != GrantClientCredentials {
+		confirm := promptui.Prompt{
+			Label:     "Validate ID tokens against the provider JWKS",
+			IsConfirm: true,
+		}
+		validateIDToken, err = confirm.Run()
+		if err != nil && err != promptui.ErrAbort {
+			return "", AppConfig{}, err
+		}
+	}
+
 	confirm := promptui.Prompt{
 		Label:     "Set this as the default app",
 		IsConfirm: true,
@@ -180,9 +391,23 @@ func interactiveSetup() (string, AppConfig, error) {
 	}
 
 	appConfig := AppConfig{
-		ClientID: clientID,
-		Domain:   domain,
-		Scope:    scope,
+		ClientID:                clientID,
+		GrantType:               grantType,
+		TokenEndpointAuthMethod: authMethod,
+		ClientAssertionKeyFile:  assertionKeyFile,
+		ClientAssertionKID:      assertionKID,
+		Domain:                  domain,
+		Scope:                   scope,
+		Username:                username,
+		PKCEMethod:              pkceMethod,
+		Port:                    callbackPorts,
+		RedirectURI:             redirectURI,
+		ValidateIDToken:         validateIDToken == "y" || validateIDToken == "Y",
+	}
+	if isSecretReference(clientSecret) {
+		appConfig.ClientSecretRef = clientSecret
+	} else {
+		appConfig.ClientSecret = clientSecret
 	}
 
 	if setAsDefault == "y" || setAsDefault == "Y" {
@@ -208,7 +433,33 @@ func listApps() {
 		}
 		fmt.Printf("    Domain: %s\n", app.Domain)
 		fmt.Printf("    Client ID: %s\n", app.ClientID)
+		if method, err := tokenEndpointAuthMethod(app); err == nil && method != AuthMethodNone {
+			fmt.Printf("    Client Auth: %s\n", method)
+		}
+		if app.ClientAssertionKeyFile != "" {
+			fmt.Printf("    Client Assertion Key: %s\n", app.ClientAssertionKeyFile)
+		}
 		fmt.Printf("    Scope: %s\n", app.Scope)
+		if app.GrantType != "" && app.GrantType != GrantAuthorizationCode {
+			fmt.Printf("    Grant: %s\n", app.GrantType)
+		}
+		if app.PKCEMethod != "" {
+			fmt.Printf("    PKCE: %s\n", app.PKCEMethod)
+		}
+		if app.Audience != "" {
+			fmt.Printf("    Audience: %s\n", app.Audience)
+		}
+		if len(app.AuthParams) > 0 {
+			fmt.Printf("    Auth Params: %s\n", formatParams(app.AuthParams))
+		}
+		if len(app.TokenParams) > 0 {
+			fmt.Printf("    Token Params: %s\n", formatParams(app.TokenParams))
+		}
+
+		// Show the stored identity
+		if identity := identitySummary(app.IdToken); identity != "" {
+			fmt.Printf("    Identity: %s\n", identity)
+		}
 
 		// Show token status
 		if app.AccessToken != "" {
@@ -256,6 +507,82 @@ func saveTokensToApp(appName string, tokens *TokenResponse) error {
 	return saveConfig()
 }
 
+// clearStoredTokens removes the access token (with its ID token and expiry)
+// and/or the refresh token stored for an app
+func clearStoredTokens(appName string, access, refresh bool) error {
+	app, exists := config.Apps[appName]
+	if !exists {
+		return fmt.Errorf("app '%s' not found", appName)
+	}
+
+	if access {
+		app.AccessToken = ""
+		app.IdToken = ""
+		app.TokenType = ""
+		app.ExpiresAt = ""
+		app.ExpiresIn = 0
+		app.ExchangedTokens = nil
+	}
+	if refresh {
+		app.RefreshToken = ""
+	}
+
+	// Save updated config
+	config.Apps[appName] = app
+	return saveConfig()
+}
+
+// saveExchangedToken caches a token exchange result for an app, dropping
+// any cached results that have expired
+func saveExchangedToken(appName, key, source, subjectToken string, tokens *TokenResponse) error {
+	app, exists := config.Apps[appName]
+	if !exists {
+		return fmt.Errorf("app '%s' not found", appName)
+	}
+
+	cached := make(ExchangeCache, len(app.ExchangedTokens)+1)
+	for k, entry := range app.ExchangedTokens {
+		if expiresAt, err := time.Parse(time.RFC3339, entry.ExpiresAt); err == nil && time.Now().Before(expiresAt) {
+			cached[k] = entry
+		}
+	}
+	cached[key] = ExchangedToken{
+		Source:           source,
+		SubjectTokenHash: subjectTokenHash(subjectToken),
+		AccessToken:      tokens.AccessToken,
+		IssuedTokenType:  tokens.IssuedTokenType,
+		TokenType:        tokens.TokenType,
+		ExpiresIn:        tokens.ExpiresIn,
+		ExpiresAt:        time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second).Format(time.RFC3339),
+	}
+	app.ExchangedTokens = cached
+
+	// Save updated config
+	config.Apps[appName] = app
+	return saveConfig()
+}
+
+// getExchangedToken returns a cached token exchange result if it is still
+// valid and was issued for the same subject token
+func getExchangedToken(appName, key, subjectToken string) (*TokenResponse, bool) {
+	entry, exists := config.Apps[appName].ExchangedTokens[key]
+	if !exists || entry.SubjectTokenHash != subjectTokenHash(subjectToken) {
+		return nil, false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, entry.ExpiresAt)
+	if err != nil || !time.Now().Before(expiresAt) {
+		return nil, false
+	}
+
+	return &TokenResponse{
+		AccessToken:     entry.AccessToken,
+		IssuedTokenType: entry.IssuedTokenType,
+		TokenType:       entry.TokenType,
+		ExpiresIn:       entry.ExpiresIn,
+	}, true
+}
+
 func isTokenValid(appName string) bool {
 	app, exists := config.Apps[appName]
 	if !exists {
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mdp/qrterminal/v3"
+)
+
+// deviceCodeGrantType is the grant_type used to poll for device authorization (RFC 8628 §3.4)
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceAuthorizationResponse is returned by the device authorization endpoint (RFC 8628 §3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURL         string `json:"verification_url"` // Google's pre-RFC name
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// deviceCodeGrant runs the device authorization grant: it requests a device
+// code, prints the verification instructions and polls the token endpoint
+// until the user approves or denies the request. A timeout set on the app or
+// with --timeout stops polling early; otherwise it lasts as long as the code.
+func deviceCodeGrant(ctx context.Context, appConfig AppConfig, timeout time.Duration) (*TokenResponse, error) {
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("provider has no device authorization endpoint; set device_authorization_endpoint for the app")
+	}
+
+	authorization, err := requestDeviceAuthorization(ctx, appConfig, metadata.DeviceAuthorizationEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization request failed: %v", err)
+	}
+
+	printDeviceInstructions(authorization)
+
+	// Poll the token endpoint (RFC 8628 §3.5)
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := time.Duration(authorization.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 5 * time.Minute
+	}
+	deadline := time.Now().Add(expiresIn)
+
+	waitCtx := ctx
+	if appConfig.Timeout != "" {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-waitCtx.Done():
+			return nil, waitError(ctx, timeout, "device authorization")
+		case <-time.After(interval):
+		}
+
+		data := url.Values{}
+		data.Set("grant_type", deviceCodeGrantType)
+		data.Set("device_code", authorization.DeviceCode)
+
+		tokens, err := requestToken(waitCtx, appConfig, data)
+		if err == nil {
+			return tokens, nil
+		}
+		if waitCtx.Err() != nil {
+			return nil, waitError(ctx, timeout, "device authorization")
+		}
+
+		tokenErr, ok := err.(*TokenError)
+		if !ok {
+			return nil, err
+		}
+		switch tokenErr.Code {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, fmt.Errorf("authorization request was denied")
+		case "expired_token":
+			return nil, fmt.Errorf("device code expired before the request was approved")
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("device code expired before the request was approved")
+}
+
+// requestDeviceAuthorization obtains a device code and user code (RFC 8628 §3.1)
+func requestDeviceAuthorization(ctx context.Context, appConfig AppConfig, endpoint string) (*DeviceAuthorizationResponse, error) {
+	data := url.Values{}
+	if appConfig.Scope != "" {
+		data.Set("scope", appConfig.Scope)
+	}
+	if appConfig.Audience != "" {
+		data.Set("audience", appConfig.Audience)
+	}
+
+	resp, err := postForm(ctx, appConfig, endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseTokenError(resp)
+	}
+
+	var authorization DeviceAuthorizationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authorization); err != nil {
+		return nil, fmt.Errorf("failed to parse device authorization response: %v", err)
+	}
+	if authorization.VerificationURI == "" {
+		authorization.VerificationURI = authorization.VerificationURL
+	}
+	if authorization.DeviceCode == "" || authorization.VerificationURI == "" {
+		return nil, fmt.Errorf("device authorization response is missing device_code or verification_uri")
+	}
+
+	return &authorization, nil
+}
+
+// printDeviceInstructions tells the user where to approve the request. Output
+// goes to stderr so that stdout stays clean for --json and --jsonpath.
+func printDeviceInstructions(authorization *DeviceAuthorizationResponse) {
+	fmt.Fprintf(os.Stderr, "🔗 To sign in, visit: %s\n", authorization.VerificationURI)
+	fmt.Fprintf(os.Stderr, "🔑 And enter the code: %s\n", authorization.UserCode)
+
+	if authorization.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "\n📱 Or scan this QR code / open: %s\n\n", authorization.VerificationURIComplete)
+		qrterminal.GenerateHalfBlock(authorization.VerificationURIComplete, qrterminal.L, os.Stderr)
+	}
+
+	fmt.Fprintln(os.Stderr, "⏳ Waiting for authorization...")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultDiscoveryTTL is how long discovered provider metadata is cached
+const defaultDiscoveryTTL = 24 * time.Hour
+
+// ProviderMetadata holds the authorization server metadata used by oauth-util
+// (OpenID Connect Discovery 1.0 / RFC 8414)
+type ProviderMetadata struct {
+	Issuer                                     string   `json:"issuer,omitempty"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                              string   `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint                           string   `json:"userinfo_endpoint,omitempty"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint,omitempty"`
+	JWKSURI                                    string   `json:"jwks_uri,omitempty"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint,omitempty"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported,omitempty"`
+	AuthorizationResponseIssParameterSupported bool     `json:"authorization_response_iss_parameter_supported,omitempty"`
+}
+
+// discoveryCacheEntry is the on-disk representation of cached metadata.
+// Discovered is false when the provider doesn't publish metadata, so we
+// don't retry on every invocation.
+type discoveryCacheEntry struct {
+	FetchedAt  time.Time        `json:"fetched_at"`
+	Discovered bool             `json:"discovered"`
+	Metadata   ProviderMetadata `json:"metadata"`
+}
+
+// metadataCache avoids re-reading the cache file within a single invocation
+var metadataCache = map[string]*ProviderMetadata{}
+
+// issuerURL returns the issuer identifier for an app, without a trailing slash
+func issuerURL(appConfig AppConfig) string {
+	issuer := appConfig.Issuer
+	if issuer == "" {
+		issuer = appConfig.Domain
+	}
+	return strings.TrimSuffix(formatURL(issuer), "/")
+}
+
+// discoveryTTL returns the metadata cache lifetime for an app
+func discoveryTTL(appConfig AppConfig) (time.Duration, error) {
+	if appConfig.DiscoveryTTL == "" {
+		return defaultDiscoveryTTL, nil
+	}
+	ttl, err := time.ParseDuration(appConfig.DiscoveryTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid discovery_ttl '%s': %v", appConfig.DiscoveryTTL, err)
+	}
+	return ttl, nil
+}
+
+// discoverProvider resolves the endpoints for an app from discovered
+// metadata, legacy defaults and the app's explicit endpoint overrides
+func discoverProvider(ctx context.Context, appConfig AppConfig) (*ProviderMetadata, error) {
+	issuer := issuerURL(appConfig)
+	if cached, ok := metadataCache[issuer]; ok {
+		return applyEndpointOverrides(*cached, appConfig), nil
+	}
+
+	ttl, err := discoveryTTL(appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := readDiscoveryCache(issuer)
+	if err != nil || time.Since(entry.FetchedAt) > ttl {
+		entry, err = fetchProviderMetadata(ctx, appConfig, issuer)
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			// A stale cache only costs an extra request, so ignore write errors
+			writeDiscoveryCache(issuer, entry)
+		}
+	}
+
+	metadata := entry.Metadata
+	if !entry.Discovered {
+		// Fall back to the Cognito-style paths used before discovery was supported
+		domainURL, _ := url.Parse(formatURL(appConfig.Domain))
+		base := fmt.Sprintf("%s://%s", domainURL.Scheme, domainURL.Host)
+		metadata = ProviderMetadata{
+			Issuer:                issuer,
+			AuthorizationEndpoint: base + "/oauth2/authorize",
+			TokenEndpoint:         base + "/oauth2/token",
+		}
+	}
+	metadataCache[issuer] = &metadata
+
+	return applyEndpointOverrides(metadata, appConfig), nil
+}
+
+// applyEndpointOverrides replaces discovered endpoints with any configured for the app
+func applyEndpointOverrides(metadata ProviderMetadata, appConfig AppConfig) *ProviderMetadata {
+	overrides := []struct {
+		value  string
+		target *string
+	}{
+		{appConfig.AuthorizationEndpoint, &metadata.AuthorizationEndpoint},
+		{appConfig.TokenEndpoint, &metadata.TokenEndpoint},
+		{appConfig.UserinfoEndpoint, &metadata.UserinfoEndpoint},
+		{appConfig.RevocationEndpoint, &metadata.RevocationEndpoint},
+		{appConfig.IntrospectionEndpoint, &metadata.IntrospectionEndpoint},
+		{appConfig.JWKSURI, &metadata.JWKSURI},
+		{appConfig.EndSessionEndpoint, &metadata.EndSessionEndpoint},
+		{appConfig.DeviceAuthorizationEndpoint, &metadata.DeviceAuthorizationEndpoint},
+	}
+	for _, override := range overrides {
+		if override.value != "" {
+			*override.target = override.value
+		}
+	}
+	return &metadata
+}
+
+// discoveryURLs returns the well-known metadata locations for an issuer, in
+// order of preference. RFC 8414 inserts the well-known suffix between the
+// host and the issuer path, OpenID Connect Discovery appends it.
+func discoveryURLs(issuer string) []string {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil
+	}
+	base := fmt.Sprintf("%s://%s", issuerURL.Scheme, issuerURL.Host)
+	path := strings.TrimSuffix(issuerURL.Path, "/")
+
+	urls := []string{
+		issuer + "/.well-known/openid-configuration",
+		base + "/.well-known/oauth-authorization-server" + path,
+	}
+	if path != "" {
+		urls = append(urls, issuer+"/.well-known/oauth-authorization-server")
+	}
+	return urls
+}
+
+// fetchProviderMetadata downloads the metadata document for an issuer. The
+// provider is only considered not to publish metadata when every well-known
+// location returns 404; any other failure is an error so it isn't cached.
+func fetchProviderMetadata(ctx context.Context, appConfig AppConfig, issuer string) (*discoveryCacheEntry, error) {
+	client, err := httpClient(appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, metadataURL := range discoveryURLs(issuer) {
+		metadata, err := fetchMetadataDocument(ctx, client, metadataURL)
+		if err == errMetadataNotFound {
+			continue
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if metadata.Issuer != "" && strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+			return nil, fmt.Errorf("discovered issuer '%s' does not match configured issuer '%s'", metadata.Issuer, issuer)
+		}
+		if metadata.Issuer == "" {
+			metadata.Issuer = issuer
+		}
+
+		return &discoveryCacheEntry{
+			FetchedAt:  time.Now(),
+			Discovered: true,
+			Metadata:   *metadata,
+		}, nil
+	}
+	if firstErr != nil {
+		return nil, fmt.Errorf("discovery failed: %v (set the endpoints on the app to skip discovery)", firstErr)
+	}
+
+	// The provider doesn't publish metadata
+	return &discoveryCacheEntry{FetchedAt: time.Now()}, nil
+}
+
+// errMetadataNotFound reports that a well-known location returned 404
+var errMetadataNotFound = errors.New("metadata not found")
+
+// fetchMetadataDocument downloads and parses a single metadata document
+func fetchMetadataDocument(ctx context.Context, client *http.Client, metadataURL string) (*ProviderMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %v", metadataURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errMetadataNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", metadataURL, resp.StatusCode)
+	}
+
+	var metadata ProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata document at %s: %v", metadataURL, err)
+	}
+	return &metadata, nil
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// discoveryCachePath returns the cache file for an issuer
+func discoveryCachePath(issuer string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(issuer, "https://"), "http://")
+	name = unsafeFilenameChars.ReplaceAllString(name, "_")
+	return filepath.Join(dataDir(), "discovery", name+".json")
+}
+
+func readDiscoveryCache(issuer string) (*discoveryCacheEntry, error) {
+	data, err := os.ReadFile(discoveryCachePath(issuer))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry discoveryCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func writeDiscoveryCache(issuer string, entry *discoveryCacheEntry) error {
+	path := discoveryCachePath(issuer)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
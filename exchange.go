@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GrantTokenExchange is the token exchange grant type (RFC 8693)
+const GrantTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// tokenTypeURNs maps the short token type names accepted on the command line
+// to their token type identifiers (RFC 8693 §3)
+var tokenTypeURNs = map[string]string{
+	"access_token":  "urn:ietf:params:oauth:token-type:access_token",
+	"refresh_token": "urn:ietf:params:oauth:token-type:refresh_token",
+	"id_token":      "urn:ietf:params:oauth:token-type:id_token",
+	"jwt":           "urn:ietf:params:oauth:token-type:jwt",
+}
+
+// tokenTypeURN returns the identifier for a short token type name; full
+// URNs are passed through unchanged
+func tokenTypeURN(tokenType string) (string, error) {
+	if strings.HasPrefix(tokenType, "urn:") {
+		return tokenType, nil
+	}
+	if urn, ok := tokenTypeURNs[strings.ToLower(tokenType)]; ok {
+		return urn, nil
+	}
+	return "", fmt.Errorf("unsupported token type '%s' (use access_token, refresh_token, id_token, jwt or a full URN)", tokenType)
+}
+
+// ExchangeRequest is a token exchange request
+type ExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	RequestedTokenType string
+	Audience           string
+	Scope              string
+}
+
+// exchangeToken trades a subject token for a new token at the app's token endpoint
+func exchangeToken(ctx context.Context, appConfig AppConfig, req ExchangeRequest) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", GrantTokenExchange)
+	data.Set("subject_token", req.SubjectToken)
+	data.Set("subject_token_type", req.SubjectTokenType)
+	if req.RequestedTokenType != "" {
+		data.Set("requested_token_type", req.RequestedTokenType)
+	}
+	if req.Audience != "" {
+		data.Set("audience", req.Audience)
+	}
+	if req.Scope != "" {
+		data.Set("scope", req.Scope)
+	}
+
+	tokens, err := requestToken(ctx, appConfig, data)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange response did not include a token")
+	}
+	return tokens, nil
+}
+
+// cacheKey derives the key an exchanged token is cached under from where the
+// subject token came from and what was requested. The subject token itself
+// is only compared by hash, so a new subject token replaces the entry.
+func (r ExchangeRequest) cacheKey(source string, tokenParams map[string]string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		source,
+		r.SubjectTokenType,
+		r.RequestedTokenType,
+		r.Audience,
+		r.Scope,
+		formatParams(tokenParams),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// subjectTokenHash identifies a subject token without storing it
+func subjectTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// introspectToken asks the provider for the server-side state of a token
+// (RFC 7662). The tokenTypeHint is "access_token" or "refresh_token".
+func introspectToken(ctx context.Context, appConfig AppConfig, token, tokenTypeHint string) (map[string]interface{}, error) {
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.IntrospectionEndpoint == "" {
+		return nil, fmt.Errorf("provider has no introspection endpoint; set introspection_endpoint for the app")
+	}
+
+	data := url.Values{}
+	data.Set("token", token)
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
+
+	resp, err := postForm(ctx, appConfig, metadata.IntrospectionEndpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseTokenError(resp)
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse introspection response: %v", err)
+	}
+	if _, ok := result["active"].(bool); !ok {
+		return nil, fmt.Errorf("introspection response is missing the active field")
+	}
+
+	return result, nil
+}
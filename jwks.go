@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// jwksTTL is how long a provider's key set is cached before being refetched
+const jwksTTL = time.Hour
+
+// JWK is a single JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwksCacheEntry is the on-disk representation of a cached key set
+type jwksCacheEntry struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	JWKS      JWKS      `json:"jwks"`
+}
+
+// PublicKey converts the JWK to a crypto.PublicKey
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %v", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %v", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %v", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %v", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+// findKeys returns the signing keys in the set matching a JWT header. Without
+// a kid, every key of the algorithm's type is a candidate.
+func (s JWKS) findKeys(kid, alg string) []JWK {
+	var keys []JWK
+	for _, key := range s.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if kid != "" && key.Kid != kid {
+			continue
+		}
+		if key.Alg != "" && key.Alg != alg {
+			continue
+		}
+		if key.Kty != keyTypeForAlg(alg) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// loadJWKS returns the key set at jwksURI, from cache when fresh. Passing
+// forceRefresh bypasses the cache, e.g. after a key rotation.
+func loadJWKS(ctx context.Context, appConfig AppConfig, jwksURI string, forceRefresh bool) (*JWKS, error) {
+	path := filepath.Join(dataDir(), "jwks", unsafeFilenameChars.ReplaceAllString(jwksURI, "_")+".json")
+
+	if !forceRefresh {
+		if data, err := os.ReadFile(path); err == nil {
+			var entry jwksCacheEntry
+			if err := json.Unmarshal(data, &entry); err == nil && time.Since(entry.FetchedAt) < jwksTTL {
+				return &entry.JWKS, nil
+			}
+		}
+	}
+
+	client, err := httpClient(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %v", err)
+	}
+
+	// A stale cache only costs an extra request, so ignore write errors
+	if data, err := json.MarshalIndent(jwksCacheEntry{FetchedAt: time.Now(), JWKS: jwks}, "", "  "); err == nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			os.WriteFile(path, data, 0644)
+		}
+	}
+
+	return &jwks, nil
+}
+
+// readJWKSFile loads a key set, or a single key, from a local file
+func readJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+	}
+
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %v", err)
+	}
+	if len(jwks.Keys) == 0 {
+		var key JWK
+		if err := json.Unmarshal(data, &key); err == nil && key.Kty != "" {
+			jwks.Keys = []JWK{key}
+		}
+	}
+	return &jwks, nil
+}
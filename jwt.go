@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// defaultClockSkew is the tolerance applied to time-based claims
+const defaultClockSkew = 60 * time.Second
+
+// JWT is a decoded (but not necessarily verified) JSON Web Token
+type JWT struct {
+	Header    map[string]interface{}
+	Claims    map[string]interface{}
+	signed    []byte
+	signature []byte
+}
+
+// parseJWT decodes a compact serialized JWS without verifying it
+func parseJWT(token string) (*JWT, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a JWT (expected 3 parts, got %d)", len(parts))
+	}
+
+	jwt := &JWT{signed: []byte(parts[0] + "." + parts[1])}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT header encoding: %v", err)
+	}
+	if err := json.Unmarshal(header, &jwt.Header); err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %v", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT payload encoding: %v", err)
+	}
+	if err := json.Unmarshal(payload, &jwt.Claims); err != nil {
+		return nil, fmt.Errorf("invalid JWT payload: %v", err)
+	}
+
+	jwt.signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT signature encoding: %v", err)
+	}
+
+	return jwt, nil
+}
+
+// HeaderString returns a string header parameter
+func (t *JWT) HeaderString(name string) string {
+	value, _ := t.Header[name].(string)
+	return value
+}
+
+// ClaimString returns a string claim
+func (t *JWT) ClaimString(name string) string {
+	value, _ := t.Claims[name].(string)
+	return value
+}
+
+// ClaimTime returns a NumericDate claim as a time
+func (t *JWT) ClaimTime(name string) (time.Time, bool) {
+	value, ok := t.Claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Audience returns the aud claim, which may be a string or an array
+func (t *JWT) Audience() []string {
+	switch aud := t.Claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var audiences []string
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	}
+	return nil
+}
+
+// keyTypeForAlg returns the JWK key type used by a JWS algorithm
+func keyTypeForAlg(alg string) string {
+	switch alg {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		return "RSA"
+	case "ES256", "ES384", "ES512":
+		return "EC"
+	case "EdDSA":
+		return "OKP"
+	}
+	return ""
+}
+
+// hashForAlg returns the hash function used by a JWS algorithm
+func hashForAlg(alg string) crypto.Hash {
+	switch alg[len(alg)-3:] {
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+// VerifySignature checks the token signature with the given public key
+func (t *JWT) VerifySignature(key crypto.PublicKey) error {
+	alg := t.HeaderString("alg")
+	if keyTypeForAlg(alg) == "" {
+		return fmt.Errorf("unsupported signing algorithm '%s'", alg)
+	}
+
+	if alg == "EdDSA" {
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		if !ed25519.Verify(edKey, t.signed, t.signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+
+	hash := hashForAlg(alg)
+	hasher := hash.New()
+	hasher.Write(t.signed)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, hash, digest, t.signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+		if err := rsa.VerifyPSS(rsaKey, hash, digest, t.signature, opts); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match algorithm %s", alg)
+		}
+		// JWS encodes ECDSA signatures as the fixed-width concatenation R || S
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	}
+	return nil
+}
+
+// verifyWithJWKS verifies the signature against the matching keys in a key
+// set, succeeding if any of them verifies it
+func (t *JWT) verifyWithJWKS(jwks *JWKS) error {
+	candidates := jwks.findKeys(t.HeaderString("kid"), t.HeaderString("alg"))
+	if len(candidates) == 0 {
+		return fmt.Errorf("no matching key found for kid '%s'", t.HeaderString("kid"))
+	}
+	var err error
+	for _, jwk := range candidates {
+		var key crypto.PublicKey
+		if key, err = jwk.PublicKey(); err != nil {
+			continue
+		}
+		if err = t.VerifySignature(key); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifyWithProviderJWKS verifies a token against the provider's key set,
+// refetching the key set once in case the provider rotated keys
+func verifyWithProviderJWKS(ctx context.Context, appConfig AppConfig, metadata *ProviderMetadata, jwt *JWT) error {
+	if metadata.JWKSURI == "" {
+		return fmt.Errorf("provider has no JWKS endpoint; set jwks_uri for the app")
+	}
+
+	jwks, err := loadJWKS(ctx, appConfig, metadata.JWKSURI, false)
+	if err != nil {
+		return err
+	}
+	if len(jwks.findKeys(jwt.HeaderString("kid"), jwt.HeaderString("alg"))) == 0 {
+		if jwks, err = loadJWKS(ctx, appConfig, metadata.JWKSURI, true); err != nil {
+			return err
+		}
+	}
+	return jwt.verifyWithJWKS(jwks)
+}
+
+// clockSkew returns the time-claim tolerance for an app
+func clockSkew(appConfig AppConfig) (time.Duration, error) {
+	if appConfig.ClockSkew == "" {
+		return defaultClockSkew, nil
+	}
+	skew, err := time.ParseDuration(appConfig.ClockSkew)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock_skew '%s': %v", appConfig.ClockSkew, err)
+	}
+	return skew, nil
+}
+
+// validateIDToken verifies an ID token's signature against the provider
+// JWKS and checks its claims (OpenID Connect Core §3.1.3.7). The nonce is
+// only checked when expectedNonce is set.
+func validateIDToken(ctx context.Context, appConfig AppConfig, idToken, expectedNonce string) error {
+	jwt, err := parseJWT(idToken)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return err
+	}
+
+	// Signature
+	if err := verifyWithProviderJWKS(ctx, appConfig, metadata, jwt); err != nil {
+		return err
+	}
+
+	// Issuer and audience
+	if iss := jwt.ClaimString("iss"); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(metadata.Issuer, "/") {
+		return fmt.Errorf("issuer mismatch: got '%s', expected '%s'", iss, metadata.Issuer)
+	}
+	audiences := jwt.Audience()
+	audienceMatch := false
+	for _, aud := range audiences {
+		if aud == appConfig.ClientID {
+			audienceMatch = true
+			break
+		}
+	}
+	if !audienceMatch {
+		return fmt.Errorf("audience %v does not include client ID '%s'", audiences, appConfig.ClientID)
+	}
+	azp := jwt.ClaimString("azp")
+	if len(audiences) > 1 && azp == "" {
+		return fmt.Errorf("azp claim is required when there are multiple audiences")
+	}
+	if azp != "" && azp != appConfig.ClientID {
+		return fmt.Errorf("authorized party mismatch: got '%s', expected '%s'", azp, appConfig.ClientID)
+	}
+
+	// Time-based claims
+	skew, err := clockSkew(appConfig)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	exp, ok := jwt.ClaimTime("exp")
+	if !ok {
+		return fmt.Errorf("missing exp claim")
+	}
+	if now.After(exp.Add(skew)) {
+		return fmt.Errorf("token expired at %s", exp.Format(time.RFC3339))
+	}
+	iat, ok := jwt.ClaimTime("iat")
+	if !ok {
+		return fmt.Errorf("missing iat claim")
+	}
+	if iat.After(now.Add(skew)) {
+		return fmt.Errorf("token issued in the future (iat %s)", iat.Format(time.RFC3339))
+	}
+	if nbf, ok := jwt.ClaimTime("nbf"); ok && nbf.After(now.Add(skew)) {
+		return fmt.Errorf("token not valid before %s", nbf.Format(time.RFC3339))
+	}
+
+	// Nonce
+	if expectedNonce != "" {
+		return jwt.verifyNonce(expectedNonce)
+	}
+
+	return nil
+}
+
+// verifyNonce checks that the token's nonce claim matches the nonce sent in
+// the authorization request, binding the ID token to this login
+func (t *JWT) verifyNonce(expectedNonce string) error {
+	nonce := t.ClaimString("nonce")
+	if nonce == "" {
+		return fmt.Errorf("ID token has no nonce claim, but a nonce was sent in the authorization request")
+	}
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(expectedNonce)) != 1 {
+		return fmt.Errorf("ID token nonce does not match the authorization request; the token was not issued for this login (possible replay)")
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeys holds one locally generated key per supported algorithm
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey, ed: edKey}
+}
+
+// signer returns the key used for a JWS algorithm
+func (k testKeys) signer(alg string) crypto.Signer {
+	switch keyTypeForAlg(alg) {
+	case "RSA":
+		return k.rsa
+	case "EC":
+		return k.ec
+	}
+	return k.ed
+}
+
+// signTestToken builds a compact JWS with the given header fields and claims
+func signTestToken(t *testing.T, key crypto.Signer, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	var signature []byte
+	var err error
+	if alg == "EdDSA" {
+		signature = ed25519.Sign(key.(ed25519.PrivateKey), []byte(signed))
+	} else {
+		hash := hashForAlg(alg)
+		hasher := hash.New()
+		hasher.Write([]byte(signed))
+		digest := hasher.Sum(nil)
+
+		switch keyTypeForAlg(alg) {
+		case "RSA":
+			if strings.HasPrefix(alg, "PS") {
+				opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+				signature, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, digest, opts)
+			} else {
+				signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, digest)
+			}
+		case "EC":
+			// JWS encodes ECDSA signatures as R || S, each padded to the curve size
+			var r, s *big.Int
+			r, s, err = ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest)
+			if err == nil {
+				signature = make([]byte, 64)
+				r.FillBytes(signature[:32])
+				s.FillBytes(signature[32:])
+			}
+		}
+	}
+	if err != nil {
+		t.Fatalf("failed to sign test token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// publicJWK converts a public key to its JWK representation
+func publicJWK(key crypto.PublicKey, kid string) JWK {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Kid: kid, N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return JWK{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(x), Y: encode(y)}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: kid, Crv: "Ed25519", X: encode(key)}
+	}
+	return JWK{}
+}
+
+func TestVerifySignature(t *testing.T) {
+	keys := newTestKeys(t)
+	otherKeys := newTestKeys(t)
+	claims := map[string]interface{}{"sub": "user-1"}
+
+	tests := []struct {
+		name    string
+		alg     string
+		key     crypto.PublicKey
+		tamper  bool
+		wantErr bool
+	}{
+		{"RS256", "RS256", keys.rsa.Public(), false, false},
+		{"PS256", "PS256", keys.rsa.Public(), false, false},
+		{"ES256", "ES256", keys.ec.Public(), false, false},
+		{"EdDSA", "EdDSA", keys.ed.Public(), false, false},
+		{"RS256 with another key", "RS256", otherKeys.rsa.Public(), false, true},
+		{"ES256 with another key", "ES256", otherKeys.ec.Public(), false, true},
+		{"EdDSA with another key", "EdDSA", otherKeys.ed.Public(), false, true},
+		{"PS256 with tampered claims", "PS256", keys.rsa.Public(), true, true},
+		{"ES256 with tampered claims", "ES256", keys.ec.Public(), true, true},
+		{"RS256 with an EC key", "RS256", keys.ec.Public(), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signTestToken(t, keys.signer(tt.alg), tt.alg, "", claims)
+			if tt.tamper {
+				parts := strings.Split(token, ".")
+				parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+				token = strings.Join(parts, ".")
+			}
+
+			jwt, err := parseJWT(token)
+			if err != nil {
+				t.Fatalf("parseJWT: %v", err)
+			}
+			err = jwt.VerifySignature(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureRejectsUnsupportedAlg(t *testing.T) {
+	keys := newTestKeys(t)
+	token := signTestToken(t, keys.rsa, "RS256", "", map[string]interface{}{"sub": "user-1"})
+	parts := strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+
+	jwt, err := parseJWT(strings.Join(parts, "."))
+	if err != nil {
+		t.Fatalf("parseJWT: %v", err)
+	}
+	if err := jwt.VerifySignature(keys.rsa.Public()); err == nil {
+		t.Error("expected alg none to be rejected")
+	}
+}
+
+// newTestProvider serves discovery metadata and a JWKS with the given keys
+func newTestProvider(t *testing.T, jwks JWKS) *httptest.Server {
+	t.Helper()
+
+	// Keep the discovery and JWKS caches out of the real config directory
+	t.Setenv("HOME", t.TempDir())
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:  server.URL,
+			JWKSURI: server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestValidateIDToken(t *testing.T) {
+	keys := newTestKeys(t)
+	otherKeys := newTestKeys(t)
+	rotatedKeys := newTestKeys(t)
+	server := newTestProvider(t, JWKS{Keys: []JWK{
+		publicJWK(rotatedKeys.rsa.Public(), "rsa-0"),
+		publicJWK(keys.rsa.Public(), "rsa-1"),
+		publicJWK(keys.ec.Public(), "ec-1"),
+		publicJWK(keys.ed.Public(), "ed-1"),
+	}})
+	appConfig := AppConfig{ClientID: "client-1", Domain: server.URL, ClockSkew: "30s"}
+
+	now := time.Now()
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   server.URL,
+			"sub":   "user-1",
+			"aud":   "client-1",
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"iat":   now.Unix(),
+			"nonce": "nonce-1",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		alg     string
+		kid     string
+		key     crypto.Signer
+		modify  func(claims map[string]interface{})
+		nonce   string
+		wantErr string
+	}{
+		{name: "valid RS256", alg: "RS256", kid: "rsa-1"},
+		{name: "valid PS256", alg: "PS256", kid: "rsa-1"},
+		{name: "valid ES256", alg: "ES256", kid: "ec-1"},
+		{name: "valid EdDSA", alg: "EdDSA", kid: "ed-1"},
+		{name: "valid nonce", alg: "RS256", kid: "rsa-1", nonce: "nonce-1"},
+		{name: "signed with an unknown key", alg: "RS256", kid: "rsa-1", key: otherKeys.rsa, wantErr: "invalid signature"},
+		{name: "unknown kid", alg: "RS256", kid: "rsa-2", wantErr: "no matching key"},
+		{name: "no kid with several keys of the same type", alg: "RS256"},
+		{name: "no kid signed with an unknown key", alg: "RS256", key: otherKeys.rsa, wantErr: "invalid signature"},
+		{
+			name: "wrong issuer", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+			wantErr: "issuer mismatch",
+		},
+		{
+			name: "wrong audience", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["aud"] = "client-2" },
+			wantErr: "does not include client ID",
+		},
+		{
+			name: "audience list including the client", alg: "RS256", kid: "rsa-1",
+			modify: func(c map[string]interface{}) {
+				c["aud"] = []string{"api", "client-1"}
+				c["azp"] = "client-1"
+			},
+		},
+		{
+			name: "multiple audiences without azp", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["aud"] = []string{"api", "client-1"} },
+			wantErr: "azp claim is required",
+		},
+		{
+			name: "azp for another client", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["azp"] = "client-2" },
+			wantErr: "authorized party mismatch",
+		},
+		{
+			name: "expired", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["exp"] = now.Add(-time.Minute).Unix() },
+			wantErr: "token expired",
+		},
+		{
+			name: "expired within clock skew", alg: "RS256", kid: "rsa-1",
+			modify: func(c map[string]interface{}) { c["exp"] = now.Add(-10 * time.Second).Unix() },
+		},
+		{
+			name: "missing exp", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { delete(c, "exp") },
+			wantErr: "missing exp",
+		},
+		{
+			name: "not yet valid", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["nbf"] = now.Add(time.Minute).Unix() },
+			wantErr: "not valid before",
+		},
+		{
+			name: "nbf within clock skew", alg: "RS256", kid: "rsa-1",
+			modify: func(c map[string]interface{}) { c["nbf"] = now.Add(10 * time.Second).Unix() },
+		},
+		{
+			name: "issued in the future", alg: "RS256", kid: "rsa-1",
+			modify:  func(c map[string]interface{}) { c["iat"] = now.Add(time.Minute).Unix() },
+			wantErr: "issued in the future",
+		},
+		{
+			name: "nonce mismatch", alg: "RS256", kid: "rsa-1", nonce: "nonce-2",
+			wantErr: "nonce",
+		},
+		{
+			name: "missing nonce", alg: "RS256", kid: "rsa-1", nonce: "nonce-1",
+			modify:  func(c map[string]interface{}) { delete(c, "nonce") },
+			wantErr: "nonce",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			key := tt.key
+			if key == nil {
+				key = keys.signer(tt.alg)
+			}
+			token := signTestToken(t, key, tt.alg, tt.kid, claims)
+
+			err := validateIDToken(context.Background(), appConfig, token, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateIDToken() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateIDToken() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
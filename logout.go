@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/browser"
+)
+
+// logoutCallbackPath is where the loopback server receives the
+// post-logout redirect from the provider
+const logoutCallbackPath = "/logout"
+
+// StartLogout ends the user's session at the provider using OpenID Connect
+// RP-Initiated Logout. The browser is sent to the end_session_endpoint and,
+// when the post-logout redirect points at the loopback server, we wait for
+// the provider to redirect back.
+func (o *OAuthFlow) StartLogout(ctx context.Context, appConfig AppConfig, idToken string, options FlowOptions) error {
+	o.port = options.Port
+
+	pages, err := loadCallbackPages(options.AppName, appConfig)
+	if err != nil {
+		return err
+	}
+	o.pages = pages
+
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return fmt.Errorf("provider discovery failed: %v", err)
+	}
+	if metadata.EndSessionEndpoint == "" {
+		return fmt.Errorf("provider has no end session endpoint; set end_session_endpoint for the app")
+	}
+	o.metadata = metadata
+
+	state, err := randomString(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate state: %v", err)
+	}
+	o.state = state
+
+	// Serve the post-logout redirect ourselves unless it points elsewhere.
+	// By default it shares the scheme, host and any fixed port of the login
+	// redirect.
+	redirectURI := appConfig.PostLogoutRedirectURI
+	var redirectURL *url.URL
+	if redirectURI == "" {
+		loginURL, err := appRedirectURL(appConfig)
+		if err != nil {
+			return err
+		}
+		redirectURL = &url.URL{Scheme: loginURL.Scheme, Host: loginURL.Host, Path: logoutCallbackPath}
+	} else if loopbackURL, err := parseLoopbackRedirect(redirectURI); err == nil {
+		redirectURL = loopbackURL
+	}
+
+	waitForRedirect := redirectURL != nil
+	if waitForRedirect {
+		if err := o.listenOn(appConfig, redirectURL); err != nil {
+			return err
+		}
+		if err := o.startCallbackServer(ctx, redirectURL.Path, o.handleLogoutCallback); err != nil {
+			return fmt.Errorf("failed to start callback server: %v", err)
+		}
+		defer o.cleanup(ctx)
+		redirectURI = o.boundURL(redirectURL)
+	}
+
+	params := url.Values{}
+	params.Set("client_id", appConfig.ClientID)
+	params.Set("post_logout_redirect_uri", redirectURI)
+	params.Set("state", o.state)
+	if idToken != "" {
+		params.Set("id_token_hint", idToken)
+	}
+	separator := "?"
+	if strings.Contains(metadata.EndSessionEndpoint, "?") {
+		separator = "&"
+	}
+	logoutURL := metadata.EndSessionEndpoint + separator + params.Encode()
+
+	if err := browser.OpenURL(logoutURL); err != nil {
+		return fmt.Errorf("failed to open browser: %v", err)
+	}
+
+	if !waitForRedirect {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, flowTimeoutOrDefault(options.Timeout))
+	defer cancel()
+	select {
+	case <-o.loggedOut:
+		return nil
+	case err := <-o.authError:
+		return fmt.Errorf("logout error: %s", err)
+	case <-waitCtx.Done():
+		return waitError(ctx, options.Timeout, "the provider to complete logout")
+	}
+}
+
+func (o *OAuthFlow) handleLogoutCallback(w http.ResponseWriter, r *http.Request) {
+	// We always send state and providers must echo it, so a missing state
+	// means the request didn't come from the logout we started
+	if state := r.URL.Query().Get("state"); subtle.ConstantTimeCompare([]byte(state), []byte(o.state)) != 1 {
+		o.pages.renderError(w, &callbackError{
+			title:   "Invalid state parameter",
+			message: "The logout response did not match the request started by oauth-util.",
+		})
+		o.authError <- "state mismatch (possible CSRF attempt)"
+		return
+	}
+
+	o.pages.renderSuccess(w, "Logged Out", "Your session with the provider has ended.")
+
+	o.loggedOut <- struct{}{}
+}
@@ -23,14 +23,24 @@ func init() {
 	rootCmd.AddCommand(configureCmd)
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(refreshCmd)
+	rootCmd.AddCommand(decodeCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(setDefaultCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(clearTokensCmd)
+	rootCmd.AddCommand(revokeCmd)
+	rootCmd.AddCommand(logoutCmd)
+	rootCmd.AddCommand(introspectCmd)
+	rootCmd.AddCommand(exchangeCmd)
+	rootCmd.AddCommand(whoamiCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
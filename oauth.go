@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/subtle"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,184 +23,431 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	TokenType    string `json:"token_type,omitempty"`
 	ExpiresIn    int    `json:"expires_in,omitempty"`
+
+	// IssuedTokenType is set by token exchange responses (RFC 8693)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
 
 type OAuthFlow struct {
-	server    *http.Server
-	authCode  chan string
-	authError chan string
-	port      string
+	server       *http.Server
+	authCode     chan string
+	authError    chan string
+	loggedOut    chan struct{}
+	port         string
+	host         string
+	redirectURI  string
+	tlsConfig    *tls.Config
+	pages        *callbackPages
+	pkceMethod   string
+	responseMode string
+	codeVerifier string
+	state        string
+	nonce        string
+	metadata     *ProviderMetadata
 }
 
 func NewOAuthFlow() *OAuthFlow {
 	return &OAuthFlow{
 		authCode:  make(chan string, 1),
 		authError: make(chan string, 1),
+		loggedOut: make(chan struct{}, 1),
+		host:      defaultCallbackHost,
 	}
 }
 
-func (o *OAuthFlow) StartFlow(appConfig AppConfig, port string) (*TokenResponse, error) {
-	o.port = port
+// FlowOptions are per-invocation settings for an interactive flow
+type FlowOptions struct {
+	// AppName is shown on the callback pages
+	AppName string
+	// Port is a comma-separated list of callback ports to try in order;
+	// "0" binds any free port
+	Port string
+	// NoBrowser prints the authorization URL instead of opening a browser
+	// and reads the redirect URL back from the terminal
+	NoBrowser bool
+	// Timeout is how long to wait for the user to complete the flow
+	Timeout time.Duration
+	// PasswordStdin reads the password grant's password from stdin
+	PasswordStdin bool
+}
+
+// StartFlow runs the authorization code flow. A port in the app's redirect
+// URI takes precedence over options.Port.
+func (o *OAuthFlow) StartFlow(ctx context.Context, appConfig AppConfig, options FlowOptions) (*TokenResponse, error) {
+	o.port = options.Port
+
+	pages, err := loadCallbackPages(options.AppName, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	o.pages = pages
+
+	redirectURL, err := appRedirectURL(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.listenOn(appConfig, redirectURL); err != nil {
+		return nil, err
+	}
+
+	responseMode, err := normalizeResponseMode(appConfig.ResponseMode)
+	if err != nil {
+		return nil, err
+	}
+	if responseMode == ResponseModeFormPost && options.NoBrowser {
+		return nil, fmt.Errorf("response_mode=form_post can't be used with --no-browser, since the response is posted straight to the callback server")
+	}
+	o.responseMode = responseMode
+
+	// Generate PKCE verifier for this flow
+	pkceMethod, err := normalizePKCEMethod(appConfig.PKCEMethod)
+	if err != nil {
+		return nil, err
+	}
+	o.pkceMethod = pkceMethod
+	if o.pkceMethod != PKCEMethodDisabled {
+		verifier, err := generateCodeVerifier()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate PKCE code verifier: %v", err)
+		}
+		o.codeVerifier = verifier
+	}
 
-	// Start local server
-	if err := o.startCallbackServer(); err != nil {
-		return nil, fmt.Errorf("failed to start callback server: %v", err)
+	// Generate state to bind the callback to this flow
+	state, err := randomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate state: %v", err)
 	}
-	defer o.cleanup()
+	o.state = state
+
+	// Generate a nonce to bind the ID token to this flow (OIDC Core §3.1.2.1)
+	if hasScope(appConfig.Scope, "openid") {
+		nonce, err := randomString(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %v", err)
+		}
+		o.nonce = nonce
+	}
+
+	// Resolve provider endpoints
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return nil, fmt.Errorf("provider discovery failed: %v", err)
+	}
+	o.metadata = metadata
+
+	// Start local server. Paste mode doesn't need it, but still serves the
+	// callback when the browser can reach it (e.g. through an SSH tunnel).
+	if err := o.startCallbackServer(ctx, redirectURL.Path, o.handleCallback); err != nil {
+		if !options.NoBrowser {
+			return nil, fmt.Errorf("failed to start callback server: %v", err)
+		}
+		ports, _ := parsePortList(o.port)
+		if len(ports) == 0 || ports[0] == "0" {
+			return nil, fmt.Errorf("failed to start callback server: %v", err)
+		}
+		o.port = ports[0]
+		fmt.Fprintf(os.Stderr, "⚠️  Callback server not started: %v\n", err)
+	}
+	defer o.cleanup(ctx)
+	o.redirectURI = o.boundURL(redirectURL)
 
 	// Build authorization URL
-	authURL := o.buildAuthURL(appConfig)
+	authURL, err := o.buildAuthURL(appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The wait context also stops the paste reader once the flow is over
+	waitCtx, cancel := context.WithTimeout(ctx, flowTimeoutOrDefault(options.Timeout))
+	defer cancel()
 
-	// Open browser
-	if err := browser.OpenURL(authURL); err != nil {
-		return nil, fmt.Errorf("failed to open browser: %v", err)
+	// Open browser, falling back to paste mode when there isn't one
+	if options.NoBrowser {
+		o.promptForRedirect(waitCtx, authURL)
+	} else if err := browser.OpenURL(authURL); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not open a browser: %v\n", err)
+		o.promptForRedirect(waitCtx, authURL)
 	}
 
 	// Wait for authorization code
 	select {
 	case code := <-o.authCode:
 		// Exchange code for tokens
-		tokens, err := o.exchangeCodeForTokens(code, appConfig)
+		tokens, err := o.exchangeCodeForTokens(ctx, code, appConfig)
 		if err != nil {
 			return nil, fmt.Errorf("token exchange failed: %v", err)
 		}
 		return tokens, nil
 	case err := <-o.authError:
 		return nil, fmt.Errorf("OAuth error: %s", err)
-	case <-time.After(5 * time.Minute):
-		return nil, fmt.Errorf("timeout waiting for authorization")
+	case <-waitCtx.Done():
+		return nil, waitError(ctx, options.Timeout, "authorization")
 	}
 }
 
-func (o *OAuthFlow) startCallbackServer() error {
+// flowTimeoutOrDefault returns the flow timeout, or the default when unset
+func flowTimeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultFlowTimeout
+	}
+	return timeout
+}
+
+// waitError explains why waiting on the browser ended: the invocation was
+// cancelled (e.g. Ctrl-C), or the flow timed out
+func waitError(ctx context.Context, timeout time.Duration, waitingFor string) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("cancelled while waiting for %s", waitingFor)
+	}
+	return fmt.Errorf("timeout waiting for %s after %s", waitingFor, flowTimeoutOrDefault(timeout))
+}
+
+// listenOn points the callback server at the host, and port if present, of
+// a loopback redirect URI, serving TLS for https redirect URIs
+func (o *OAuthFlow) listenOn(appConfig AppConfig, redirectURL *url.URL) error {
+	o.host = redirectURL.Hostname()
+	if redirectURL.Port() != "" {
+		o.port = redirectURL.Port()
+	}
+	if redirectURL.Scheme == "https" {
+		tlsConfig, err := callbackTLSConfig(appConfig)
+		if err != nil {
+			return err
+		}
+		o.tlsConfig = tlsConfig
+	}
+	return nil
+}
+
+// boundURL returns a loopback redirect URI with the port actually bound
+func (o *OAuthFlow) boundURL(redirectURL *url.URL) string {
+	bound := *redirectURL
+	bound.Host = net.JoinHostPort(redirectURL.Hostname(), o.port)
+	return bound.String()
+}
+
+// startCallbackServer binds the first available port from the candidate
+// list and starts serving handler at path. Binding happens synchronously so
+// that port conflicts are reported before the browser is opened.
+func (o *OAuthFlow) startCallbackServer(ctx context.Context, path string, handler http.HandlerFunc) error {
+	ports, err := parsePortList(o.port)
+	if err != nil {
+		return err
+	}
+
+	var listener net.Listener
+	var bindErrors []string
+	for _, candidate := range ports {
+		listener, err = net.Listen("tcp", listenAddress(o.host, candidate))
+		if err == nil {
+			break
+		}
+		if isAddrInUse(err) {
+			bindErrors = append(bindErrors, fmt.Sprintf("port %s is already in use", candidate))
+		} else {
+			bindErrors = append(bindErrors, fmt.Sprintf("port %s: %v", candidate, err))
+		}
+	}
+	if listener == nil {
+		return fmt.Errorf("%s; choose another port with --port (or --port 0 for any free port, if your provider allows it)", strings.Join(bindErrors, ", "))
+	}
+
+	// Record the port actually bound, which differs from the request for port 0
+	o.port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	if o.tlsConfig != nil {
+		listener = tls.NewListener(listener, o.tlsConfig)
+	}
+
 	r := mux.NewRouter()
-	r.HandleFunc("/", o.handleCallback)
+	r.HandleFunc(path, handler)
 
 	o.server = &http.Server{
-		Addr:    ":" + o.port,
-		Handler: r,
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
-	// Start server in goroutine
+	// Serve in goroutine
 	go func() {
-		if err := o.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := o.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			o.authError <- fmt.Sprintf("server error: %v", err)
 		}
 	}()
 
-	// Give server a moment to start
-	time.Sleep(100 * time.Millisecond)
 	return nil
 }
 
 func (o *OAuthFlow) handleCallback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	error := r.URL.Query().Get("error")
-
-	if error != "" {
-		http.Error(w, fmt.Sprintf("Authentication Error: %s", error), http.StatusBadRequest)
-		o.authError <- error
-		return
+	// form_post responses (and relayed fragments) arrive as a POST body
+	var params url.Values
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form body", http.StatusBadRequest)
+			return
+		}
+		params = r.PostForm
+	} else {
+		params = r.URL.Query()
+		if len(params) == 0 && o.responseMode == ResponseModeFragment {
+			// The response is in the fragment, which only the browser can see
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(fragmentRelayPage))
+			return
+		}
 	}
 
-	if code == "" {
-		http.Error(w, "No authorization code received", http.StatusBadRequest)
-		o.authError <- "no authorization code"
+	code, err := o.validateCallback(params)
+	if err != nil {
+		o.pages.renderError(w, err)
+		o.authError <- err.reason
 		return
 	}
 
 	// Send success response
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(`
-		<html>
-			<body>
-				<h1>Authentication Successful!</h1>
-				<p>You can close this window and return to the terminal.</p>
-			</body>
-		</html>
-	`))
+	o.pages.renderSuccess(w, "Authentication Successful", "oauth-util received the authorization response and is completing the sign-in.")
 
 	// Send code to main flow
 	o.authCode <- code
 }
 
-func (o *OAuthFlow) buildAuthURL(appConfig AppConfig) string {
-	redirectURI := fmt.Sprintf("http://localhost:%s/", o.port)
+// callbackError is an authorization response rejected by validateCallback.
+// title and message are shown in the browser, reason is reported by the
+// flow, and code, description and uri carry the provider's error response.
+type callbackError struct {
+	title       string
+	message     string
+	reason      string
+	code        string
+	description string
+	uri         string
+}
+
+// validateCallback checks the parameters of an authorization response,
+// whether received by the callback server or pasted into the terminal, and
+// returns the authorization code
+func (o *OAuthFlow) validateCallback(params url.Values) (string, *callbackError) {
+	// Reject responses that weren't initiated by this flow
+	if state := params.Get("state"); subtle.ConstantTimeCompare([]byte(state), []byte(o.state)) != 1 {
+		reason := "state mismatch (possible CSRF attempt)"
+		if errorCode := params.Get("error"); errorCode != "" {
+			// Some providers drop state from error responses; keep the error visible
+			reason = fmt.Sprintf("%s; response carried error '%s'", reason, errorCode)
+		}
+		return "", &callbackError{
+			title:   "Invalid state parameter",
+			message: "The authorization response did not match the request started by oauth-util. Please start the login again from the terminal.",
+			reason:  reason,
+		}
+	}
+
+	// RFC 9207: verify the authorization server that issued the response
+	iss := params.Get("iss")
+	if iss == "" && o.metadata.AuthorizationResponseIssParameterSupported {
+		return "", &callbackError{
+			title:   "Invalid issuer",
+			message: "The authorization response is missing the iss parameter.",
+			reason:  "missing iss parameter in authorization response",
+		}
+	}
+	if iss != "" && strings.TrimSuffix(iss, "/") != strings.TrimSuffix(o.metadata.Issuer, "/") {
+		return "", &callbackError{
+			title:   "Invalid issuer",
+			message: fmt.Sprintf("The authorization response was issued by %s, expected %s.", iss, o.metadata.Issuer),
+			reason:  fmt.Sprintf("issuer mismatch: got '%s', expected '%s'", iss, o.metadata.Issuer),
+		}
+	}
+
+	if errorCode := params.Get("error"); errorCode != "" {
+		description := params.Get("error_description")
+		reason := errorCode
+		if description != "" {
+			reason = fmt.Sprintf("%s: %s", errorCode, description)
+		}
+		return "", &callbackError{
+			title:       "Authentication Error",
+			message:     errorCode,
+			reason:      reason,
+			code:        errorCode,
+			description: description,
+			uri:         params.Get("error_uri"),
+		}
+	}
 
-	// Parse domain to get base URL
-	domainURL, _ := url.Parse(appConfig.Domain)
-	authEndpoint := fmt.Sprintf("%s://%s/oauth2/authorize", domainURL.Scheme, domainURL.Host)
+	code := params.Get("code")
+	if code == "" {
+		return "", &callbackError{
+			title:   "Authentication Error",
+			message: "No authorization code was received from the provider.",
+			reason:  "no authorization code",
+		}
+	}
+	return code, nil
+}
 
-	params := url.Values{}
+func (o *OAuthFlow) buildAuthURL(appConfig AppConfig) (string, error) {
+	// Optional parameters go first so they can't replace the protocol ones
+	params, err := authRequestParams(appConfig)
+	if err != nil {
+		return "", err
+	}
 	params.Set("client_id", appConfig.ClientID)
 	params.Set("response_type", "code")
 	params.Set("scope", appConfig.Scope)
-	params.Set("redirect_uri", redirectURI)
+	params.Set("redirect_uri", o.redirectURI)
+	params.Set("state", o.state)
+	if o.nonce != "" {
+		params.Set("nonce", o.nonce)
+	}
+	if o.responseMode != "" {
+		params.Set("response_mode", o.responseMode)
+	}
+	if o.codeVerifier != "" {
+		params.Set("code_challenge", codeChallenge(o.codeVerifier, o.pkceMethod))
+		params.Set("code_challenge_method", o.pkceMethod)
+	}
 
-	return fmt.Sprintf("%s?%s", authEndpoint, params.Encode())
+	// Preserve any query parameters already present on the endpoint
+	separator := "?"
+	if strings.Contains(o.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return o.metadata.AuthorizationEndpoint + separator + params.Encode(), nil
 }
 
-func (o *OAuthFlow) exchangeCodeForTokens(code string, appConfig AppConfig) (*TokenResponse, error) {
-	redirectURI := fmt.Sprintf("http://localhost:%s/", o.port)
-
-	// Parse domain to get base URL
-	domainURL, _ := url.Parse(appConfig.Domain)
-	tokenEndpoint := fmt.Sprintf("%s://%s/oauth2/token", domainURL.Scheme, domainURL.Host)
-
+func (o *OAuthFlow) exchangeCodeForTokens(ctx context.Context, code string, appConfig AppConfig) (*TokenResponse, error) {
 	// Prepare form data
 	data := url.Values{}
 	data.Set("grant_type", "authorization_code")
-	data.Set("client_id", appConfig.ClientID)
 	data.Set("code", code)
-	data.Set("redirect_uri", redirectURI)
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(data.Encode()))
-	if err != nil {
-		return nil, err
+	data.Set("redirect_uri", o.redirectURI)
+	if o.codeVerifier != "" {
+		data.Set("code_verifier", o.codeVerifier)
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// Make request
-	resp, err := client.Do(req)
+	tokens, err := requestToken(ctx, appConfig, data)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		var errorResp map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-			if desc, ok := errorResp["error_description"].(string); ok {
-				return nil, fmt.Errorf("token exchange failed: %s", desc)
-			}
-			if errMsg, ok := errorResp["error"].(string); ok {
-				return nil, fmt.Errorf("token exchange failed: %s", errMsg)
-			}
+	// Check the nonce even when full ID token validation is disabled
+	if o.nonce != "" && tokens.IdToken != "" {
+		jwt, err := parseJWT(tokens.IdToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID token: %v", err)
+		}
+		if err := jwt.verifyNonce(o.nonce); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("token exchange failed with status: %d", resp.StatusCode)
-	}
-
-	// Parse response
-	var tokens TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
-		return nil, fmt.Errorf("failed to parse token response: %v", err)
 	}
-
-	return &tokens, nil
+	return tokens, nil
 }
 
-func (o *OAuthFlow) cleanup() {
+// cleanup shuts down the callback server. Shutdown still runs when ctx has
+// been cancelled, so that an interrupted flow releases the port cleanly.
+func (o *OAuthFlow) cleanup(ctx context.Context) {
 	if o.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 1*time.Second)
 		defer cancel()
-		o.server.Shutdown(ctx)
+		o.server.Shutdown(shutdownCtx)
 	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateCallback(t *testing.T) {
+	const issuer = "https://idp.example.com"
+
+	tests := []struct {
+		name        string
+		params      url.Values
+		issRequired bool
+		wantCode    string
+		wantErr     string
+	}{
+		{
+			name:     "valid response",
+			params:   url.Values{"code": {"code-1"}, "state": {"state-1"}, "iss": {issuer}},
+			wantCode: "code-1",
+		},
+		{
+			name:     "valid response without iss",
+			params:   url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			wantCode: "code-1",
+		},
+		{
+			name:     "iss with a trailing slash",
+			params:   url.Values{"code": {"code-1"}, "state": {"state-1"}, "iss": {issuer + "/"}},
+			wantCode: "code-1",
+		},
+		{
+			name:    "missing state",
+			params:  url.Values{"code": {"code-1"}},
+			wantErr: "state mismatch",
+		},
+		{
+			name:    "wrong state",
+			params:  url.Values{"code": {"code-1"}, "state": {"state-2"}},
+			wantErr: "state mismatch",
+		},
+		{
+			name:    "error response without state",
+			params:  url.Values{"error": {"access_denied"}},
+			wantErr: "response carried error 'access_denied'",
+		},
+		{
+			name:    "iss mismatch",
+			params:  url.Values{"code": {"code-1"}, "state": {"state-1"}, "iss": {"https://evil.example.com"}},
+			wantErr: "issuer mismatch",
+		},
+		{
+			name:        "iss missing when the provider sends it",
+			params:      url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			issRequired: true,
+			wantErr:     "missing iss parameter",
+		},
+		{
+			name:    "error response",
+			params:  url.Values{"error": {"access_denied"}, "error_description": {"User said no"}, "state": {"state-1"}},
+			wantErr: "access_denied: User said no",
+		},
+		{
+			name:    "missing code",
+			params:  url.Values{"state": {"state-1"}},
+			wantErr: "no authorization code",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOAuthFlow()
+			o.state = "state-1"
+			o.metadata = &ProviderMetadata{
+				Issuer: issuer,
+				AuthorizationResponseIssParameterSupported: tt.issRequired,
+			}
+
+			code, err := o.validateCallback(tt.params)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateCallback() unexpected error: %s", err.reason)
+				}
+				if code != tt.wantCode {
+					t.Errorf("code = %q, want %q", code, tt.wantCode)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.reason, tt.wantErr) {
+				t.Errorf("validateCallback() error = %v, want reason containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
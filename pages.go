@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// CallbackPageData is available to the success and error page templates
+type CallbackPageData struct {
+	AppName          string
+	Title            string
+	Message          string
+	Error            string
+	ErrorDescription string
+	ErrorURI         string
+	AutoClose        bool
+}
+
+// callbackPages renders the pages shown in the browser after a callback
+type callbackPages struct {
+	appName   string
+	autoClose bool
+	success   *template.Template
+	failure   *template.Template
+}
+
+// loadCallbackPages parses the app's page templates, falling back to the
+// global templates and then to the built-in pages
+func loadCallbackPages(appName string, appConfig AppConfig) (*callbackPages, error) {
+	pages := &callbackPages{
+		appName:   appName,
+		autoClose: appConfig.AutoClosePage || config.AutoClosePage,
+	}
+
+	var err error
+	if pages.success, err = loadPageTemplate("success", appConfig.SuccessTemplate, config.SuccessTemplate, defaultSuccessPage); err != nil {
+		return nil, err
+	}
+	if pages.failure, err = loadPageTemplate("error", appConfig.ErrorTemplate, config.ErrorTemplate, defaultErrorPage); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// loadPageTemplate parses the first configured template file, or the built-in page
+func loadPageTemplate(name, appPath, globalPath, builtin string) (*template.Template, error) {
+	path := appPath
+	if path == "" {
+		path = globalPath
+	}
+	if path == "" {
+		return template.Must(template.New(name).Parse(builtin)), nil
+	}
+
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s page template: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// renderSuccess writes the success page
+func (p *callbackPages) renderSuccess(w http.ResponseWriter, title, message string) {
+	p.render(w, http.StatusOK, p.success, CallbackPageData{
+		Title:   title,
+		Message: message,
+	})
+}
+
+// renderError writes the error page for a rejected callback
+func (p *callbackPages) renderError(w http.ResponseWriter, err *callbackError) {
+	p.render(w, http.StatusBadRequest, p.failure, CallbackPageData{
+		Title:            err.title,
+		Message:          err.message,
+		Error:            err.code,
+		ErrorDescription: err.description,
+		ErrorURI:         err.uri,
+	})
+}
+
+func (p *callbackPages) render(w http.ResponseWriter, status int, tmpl *template.Template, data CallbackPageData) {
+	data.AppName = p.appName
+	data.AutoClose = p.autoClose
+
+	// Render to a buffer first so a broken template doesn't leave a half-written page
+	var page bytes.Buffer
+	if err := tmpl.Execute(&page, data); err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s (page template error: %v)", data.Title, data.Message, err), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(page.Bytes())
+}
+
+// pageLayout is shared by the built-in pages; the page sets the accent colour
+const pageLayout = `{{define "layout"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}{{if .AppName}} · {{.AppName}}{{end}}</title>
+<style>
+  body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center;
+         font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f4f5f7; color: #1f2328; }
+  main { max-width: 32rem; margin: 1rem; padding: 2rem 2.5rem; background: #fff; border-radius: 12px;
+         box-shadow: 0 4px 24px rgba(0, 0, 0, 0.08); border-top: 6px solid {{template "accent"}}; }
+  h1 { margin: 0 0 0.75rem; font-size: 1.5rem; }
+  p { line-height: 1.5; }
+  .app { color: #656d76; font-size: 0.875rem; text-transform: uppercase; letter-spacing: 0.05em; }
+  code { background: #f4f5f7; padding: 0.1rem 0.35rem; border-radius: 4px; }
+  .hint { color: #656d76; font-size: 0.875rem; }
+</style>
+</head>
+<body>
+<main>
+{{if .AppName}}<div class="app">{{.AppName}}</div>{{end}}
+{{template "content" .}}
+<p class="hint">{{if .AutoClose}}This window will close automatically.{{else}}You can close this window and return to the terminal.{{end}}</p>
+</main>
+{{if .AutoClose}}<script>setTimeout(function () { window.close(); }, 3000);</script>{{end}}
+</body>
+</html>{{end}}`
+
+const defaultSuccessPage = pageLayout + `{{define "accent"}}#1a7f37{{end}}
+{{- define "content"}}<h1>✅ {{.Title}}</h1>
+<p>{{.Message}}</p>{{end}}
+{{- template "layout" .}}`
+
+const defaultErrorPage = pageLayout + `{{define "accent"}}#cf222e{{end}}
+{{- define "content"}}<h1>❌ {{.Title}}</h1>
+<p>{{if .ErrorDescription}}{{.ErrorDescription}}{{else}}{{.Message}}{{end}}</p>
+{{if .Error}}<p>Error code: <code>{{.Error}}</code></p>{{end}}
+{{if .ErrorURI}}<p><a href="{{.ErrorURI}}">More information</a></p>{{end}}{{end}}
+{{- template "layout" .}}`
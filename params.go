@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// authRequestParams returns the optional authorization request parameters
+// configured for an app: the OpenID Connect parameters (Core §3.1.2.1),
+// Auth0's audience and any generic auth_params
+func authRequestParams(appConfig AppConfig) (url.Values, error) {
+	params := url.Values{}
+	for key, value := range appConfig.AuthParams {
+		params.Set(key, value)
+	}
+
+	if appConfig.MaxAge != "" {
+		if maxAge, err := strconv.Atoi(appConfig.MaxAge); err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid max_age '%s': must be a number of seconds", appConfig.MaxAge)
+		}
+	}
+	named := []struct {
+		key   string
+		value string
+	}{
+		{"audience", appConfig.Audience},
+		{"prompt", appConfig.Prompt},
+		{"login_hint", appConfig.LoginHint},
+		{"acr_values", appConfig.ACRValues},
+		{"max_age", appConfig.MaxAge},
+		{"ui_locales", appConfig.UILocales},
+	}
+	for _, param := range named {
+		if param.value != "" {
+			params.Set(param.key, param.value)
+		}
+	}
+	return params, nil
+}
+
+// applyTokenParams adds an app's generic token_params to a token request,
+// without replacing the parameters of the grant itself
+func applyTokenParams(data url.Values, appConfig AppConfig) {
+	for key, value := range appConfig.TokenParams {
+		if _, exists := data[key]; !exists {
+			data.Set(key, value)
+		}
+	}
+}
+
+// parseKeyValues parses key=value flag values into a map
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid parameter '%s': expected key=value", pair)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// mergeParams returns base overlaid with overrides, without modifying either
+func mergeParams(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// formatParams renders parameters as sorted key=value pairs for display
+func formatParams(params map[string]string) string {
+	pairs := make([]string, 0, len(params))
+	for key, value := range params {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
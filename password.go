@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+// passwordEnv is the environment variable read for the password grant
+const passwordEnv = "OAUTH_UTIL_PASSWORD"
+
+// passwordGrant runs the Resource Owner Password Credentials grant
+// (RFC 6749 §4.3). It is only meant for legacy and test tenants; the password
+// is never written to the config file.
+func passwordGrant(ctx context.Context, appConfig AppConfig, options FlowOptions) (*TokenResponse, error) {
+	if appConfig.Username == "" {
+		return nil, fmt.Errorf("username is required for the password grant; set username on the app or pass --username")
+	}
+
+	password, err := readPassword(appConfig.Username, options.PasswordStdin)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "password")
+	data.Set("username", appConfig.Username)
+	data.Set("password", password)
+	if appConfig.Scope != "" {
+		data.Set("scope", appConfig.Scope)
+	}
+	if appConfig.Audience != "" {
+		data.Set("audience", appConfig.Audience)
+	}
+
+	return requestToken(ctx, appConfig, data)
+}
+
+// readPassword returns the password from stdin when --password-stdin was
+// given, otherwise from the environment or a masked prompt
+func readPassword(username string, fromStdin bool) (string, error) {
+	// An explicit flag wins over an exported environment variable
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password from stdin: %v", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", fmt.Errorf("no password on stdin")
+		}
+		return password, nil
+	}
+
+	if password, ok := os.LookupEnv(passwordEnv); ok && password != "" {
+		return password, nil
+	}
+
+	// Prompt on stderr so that stdout stays clean for --json
+	prompt := promptui.Prompt{
+		Label:  fmt.Sprintf("Password for %s", username),
+		Mask:   '*',
+		Stdout: os.Stderr,
+	}
+	password, err := prompt.Run()
+	if err == promptui.ErrInterrupt {
+		// The prompt reads Ctrl-C as a key press, so treat it like SIGINT
+		markInterrupted()
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read password (or set %s / use --password-stdin): %v", passwordEnv, err)
+	}
+	return password, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// promptForRedirect prints the authorization URL and reads the redirect URL
+// pasted back by the user until ctx is done. Output goes to stderr so that
+// stdout stays clean for --json.
+func (o *OAuthFlow) promptForRedirect(ctx context.Context, authURL string) {
+	fmt.Fprintf(os.Stderr, "🔗 Open this URL in a browser to sign in:\n\n%s\n\n", authURL)
+	fmt.Fprintln(os.Stderr, "📋 Then paste the full URL you were redirected to (or just the code) and press Enter:")
+
+	go o.readPastedResponse(ctx, os.Stdin)
+}
+
+// readPastedResponse validates a pasted authorization response and hands the
+// code to the flow, ignoring blank lines. A bare code is only accepted after
+// confirmation, since its state can't be checked. It returns as soon as ctx is done,
+// e.g. when the browser callback completed the flow first.
+func (o *OAuthFlow) readPastedResponse(ctx context.Context, r io.Reader) {
+	// Reading stdin can't be interrupted, so lines are read separately and
+	// an abandoned read ends with the process
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// nextLine returns the next non-blank line, or false once input ends or
+	// ctx is done
+	nextLine := func() (string, bool) {
+		for {
+			select {
+			case line, more := <-lines:
+				if !more {
+					return "", false
+				}
+				if input := strings.TrimSpace(line); input != "" {
+					return input, true
+				}
+			case <-ctx.Done():
+				return "", false
+			}
+		}
+	}
+
+	for {
+		input, ok := nextLine()
+		if !ok {
+			break
+		}
+
+		params, ok := parsePastedResponse(input)
+		if !ok && strings.ContainsAny(input, "/?#=& ") {
+			fmt.Fprintln(os.Stderr, "⚠️  No code or error found. Paste the full URL you were redirected to:")
+			continue
+		}
+		if !ok {
+			// A bare code carries no state or issuer, so it can't be tied to
+			// this flow; only use it if the user confirms
+			fmt.Fprintln(os.Stderr, "⚠️  A code on its own can't be checked against the login's state or issuer, so a code from another login would be accepted.")
+			fmt.Fprint(os.Stderr, "Use it anyway? [y/N]: ")
+			answer, ok := nextLine()
+			if !ok {
+				break
+			}
+			if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+				fmt.Fprintln(os.Stderr, "📋 Paste the full URL you were redirected to and press Enter:")
+				continue
+			}
+			o.report(ctx, o.authCode, input)
+			return
+		}
+		code, err := o.validateCallback(params)
+		if err != nil {
+			o.report(ctx, o.authError, err.reason)
+			return
+		}
+		o.report(ctx, o.authCode, code)
+		return
+	}
+
+	// Without a callback server there is no other way to complete the flow
+	if o.server == nil && ctx.Err() == nil {
+		o.report(ctx, o.authError, "no redirect URL was entered")
+	}
+}
+
+// report sends a result to the flow unless it has already finished
+func (o *OAuthFlow) report(ctx context.Context, ch chan string, value string) {
+	select {
+	case ch <- value:
+	case <-ctx.Done():
+	}
+}
+
+// parsePastedResponse extracts the authorization response parameters from a
+// pasted redirect URL, with or without a scheme, or a query string. The
+// fragment is used when the query has no response (response_mode=fragment).
+// It returns false for anything else, such as a bare code.
+func parsePastedResponse(input string) (url.Values, bool) {
+	base, fragment, _ := strings.Cut(input, "#")
+	if _, query, found := strings.Cut(base, "?"); found {
+		base = query
+	}
+
+	params, err := url.ParseQuery(base)
+	if (err != nil || !isAuthorizationResponse(params)) && fragment != "" {
+		params, err = url.ParseQuery(fragment)
+	}
+	if err != nil || !isAuthorizationResponse(params) {
+		return nil, false
+	}
+	return params, true
+}
+
+// isAuthorizationResponse reports whether params carry a code or an error
+func isAuthorizationResponse(params url.Values) bool {
+	return params.Has("code") || params.Has("error")
+}
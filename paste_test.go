@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParsePastedResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   url.Values
+		wantOK bool
+	}{
+		{
+			name:   "full URL",
+			input:  "http://localhost:3000/callback?code=code-1&state=state-1&iss=https%3A%2F%2Fidp.example.com",
+			want:   url.Values{"code": {"code-1"}, "state": {"state-1"}, "iss": {"https://idp.example.com"}},
+			wantOK: true,
+		},
+		{
+			name:   "URL without a scheme",
+			input:  "localhost:3000/?code=code-1&state=state-1",
+			want:   url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			wantOK: true,
+		},
+		{
+			name:   "IP address without a scheme",
+			input:  "127.0.0.1:3000/?code=code-1&state=state-1",
+			want:   url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			wantOK: true,
+		},
+		{
+			name:   "query string",
+			input:  "code=code-1&state=state-1",
+			want:   url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			wantOK: true,
+		},
+		{
+			name:   "query string with a leading ?",
+			input:  "?code=code-1&state=state-1",
+			want:   url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			wantOK: true,
+		},
+		{
+			name:   "fragment response",
+			input:  "http://localhost:3000/#code=code-1&state=state-1",
+			want:   url.Values{"code": {"code-1"}, "state": {"state-1"}},
+			wantOK: true,
+		},
+		{
+			name:   "error response",
+			input:  "http://localhost:3000/?error=access_denied&error_description=User+said+no&state=state-1",
+			want:   url.Values{"error": {"access_denied"}, "error_description": {"User said no"}, "state": {"state-1"}},
+			wantOK: true,
+		},
+		{
+			name:  "bare code",
+			input: "SplxlOBeZQQYbYS6WxSbIA",
+		},
+		{
+			name:  "URL without a response",
+			input: "http://localhost:3000/?state=state-1",
+		},
+		{
+			name:  "code in another parameter",
+			input: "http://localhost:3000/?postcode=code-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePastedResponse(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("parsePastedResponse(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePastedResponse(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// PKCE code challenge methods (RFC 7636)
+const (
+	PKCEMethodS256     = "S256"
+	PKCEMethodPlain    = "plain"
+	PKCEMethodDisabled = "disabled"
+)
+
+// normalizePKCEMethod validates a configured PKCE method, defaulting to S256
+func normalizePKCEMethod(method string) (string, error) {
+	switch strings.ToLower(method) {
+	case "", "s256":
+		return PKCEMethodS256, nil
+	case "plain":
+		return PKCEMethodPlain, nil
+	case "disabled", "none", "off":
+		return PKCEMethodDisabled, nil
+	default:
+		return "", fmt.Errorf("invalid PKCE method '%s' (expected S256, plain or disabled)", method)
+	}
+}
+
+// generateCodeVerifier creates a high-entropy PKCE code verifier.
+// 32 random bytes encode to a 43 character verifier, the minimum length
+// allowed by RFC 7636.
+func generateCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// codeChallenge derives the code challenge for a verifier using the given method
+func codeChallenge(verifier, method string) string {
+	if method == PKCEMethodPlain {
+		return verifier
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestNormalizePKCEMethod(t *testing.T) {
+	tests := []struct {
+		method  string
+		want    string
+		wantErr bool
+	}{
+		{"", PKCEMethodS256, false},
+		{"S256", PKCEMethodS256, false},
+		{"s256", PKCEMethodS256, false},
+		{"plain", PKCEMethodPlain, false},
+		{"PLAIN", PKCEMethodPlain, false},
+		{"disabled", PKCEMethodDisabled, false},
+		{"none", PKCEMethodDisabled, false},
+		{"off", PKCEMethodDisabled, false},
+		{"S512", "", true},
+		{"sha256", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			got, err := normalizePKCEMethod(tt.method)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizePKCEMethod(%q) error = %v, wantErr %v", tt.method, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizePKCEMethod(%q) = %q, want %q", tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 Appendix B
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{PKCEMethodS256, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		{PKCEMethodPlain, verifier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if got := codeChallenge(verifier, tt.method); got != tt.want {
+				t.Errorf("codeChallenge(%q) = %q, want %q", tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateCodeVerifier(t *testing.T) {
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 §4.1: 43 to 128 characters
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("verifier length = %d, want 43-128", len(verifier))
+	}
+}
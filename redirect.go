@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultCallbackHost is the loopback host used when an app has no redirect URI
+const defaultCallbackHost = "localhost"
+
+// parseLoopbackRedirect validates a redirect URI served by the local callback
+// server. Only loopback hosts are accepted (RFC 8252 §7.3) so the server is
+// never reachable from the network.
+func parseLoopbackRedirect(redirectURI string) (*url.URL, error) {
+	redirectURL, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URI '%s': %v", redirectURI, err)
+	}
+	if redirectURL.Scheme != "http" && redirectURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid redirect URI '%s': scheme must be http or https", redirectURI)
+	}
+	if !isLoopbackHost(redirectURL.Hostname()) {
+		return nil, fmt.Errorf("invalid redirect URI '%s': host must be localhost, 127.0.0.1 or [::1]", redirectURI)
+	}
+	if redirectURL.Fragment != "" {
+		return nil, fmt.Errorf("invalid redirect URI '%s': fragments are not allowed", redirectURI)
+	}
+	if redirectURL.Path == "" {
+		redirectURL.Path = "/"
+	}
+	return redirectURL, nil
+}
+
+// appRedirectURL returns the app's loopback redirect URI, which defaults to
+// http://localhost/ (https with callback_tls) on the callback port
+func appRedirectURL(appConfig AppConfig) (*url.URL, error) {
+	if appConfig.RedirectURI == "" {
+		scheme := "http"
+		if appConfig.CallbackTLS {
+			scheme = "https"
+		}
+		return &url.URL{Scheme: scheme, Host: defaultCallbackHost, Path: "/"}, nil
+	}
+
+	redirectURL, err := parseLoopbackRedirect(appConfig.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+	if appConfig.CallbackTLS && redirectURL.Scheme != "https" {
+		return nil, fmt.Errorf("callback TLS is enabled but redirect URI '%s' is not https", appConfig.RedirectURI)
+	}
+	return redirectURL, nil
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listenAddress returns the address to bind for a loopback host and port.
+// localhost is bound as 127.0.0.1, which is where browsers fall back to
+// when it also resolves to ::1.
+func listenAddress(host, port string) string {
+	if strings.EqualFold(host, "localhost") {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
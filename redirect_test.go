@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestParseLoopbackRedirect(t *testing.T) {
+	tests := []struct {
+		uri      string
+		wantHost string
+		wantPort string
+		wantPath string
+		wantErr  bool
+	}{
+		{uri: "http://localhost", wantHost: "localhost", wantPath: "/"},
+		{uri: "http://localhost:3000/", wantHost: "localhost", wantPort: "3000", wantPath: "/"},
+		{uri: "http://127.0.0.1:8455/oauth/callback", wantHost: "127.0.0.1", wantPort: "8455", wantPath: "/oauth/callback"},
+		{uri: "http://127.0.0.2/cb", wantHost: "127.0.0.2", wantPath: "/cb"},
+		{uri: "http://[::1]:3000/cb", wantHost: "::1", wantPort: "3000", wantPath: "/cb"},
+		{uri: "https://localhost:8443/callback", wantHost: "localhost", wantPort: "8443", wantPath: "/callback"},
+		{uri: "http://LOCALHOST:3000", wantHost: "LOCALHOST", wantPort: "3000", wantPath: "/"},
+		{uri: "http://example.com/callback", wantErr: true},
+		{uri: "http://0.0.0.0:3000/", wantErr: true},
+		{uri: "http://192.168.1.10:3000/", wantErr: true},
+		{uri: "http://localhost.example.com/", wantErr: true},
+		{uri: "myapp://callback", wantErr: true},
+		{uri: "localhost:3000/callback", wantErr: true},
+		{uri: "http://localhost:3000/#frag", wantErr: true},
+		{uri: "http://local host/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			got, err := parseLoopbackRedirect(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLoopbackRedirect(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Hostname() != tt.wantHost || got.Port() != tt.wantPort || got.Path != tt.wantPath {
+				t.Errorf("parseLoopbackRedirect(%q) = host %q port %q path %q, want host %q port %q path %q",
+					tt.uri, got.Hostname(), got.Port(), got.Path, tt.wantHost, tt.wantPort, tt.wantPath)
+			}
+		})
+	}
+}
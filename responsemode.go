@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Response modes for returning the authorization response (OAuth 2.0
+// Multiple Response Type Encoding Practices, OAuth 2.0 Form Post Response Mode)
+const (
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+	ResponseModeFormPost = "form_post"
+)
+
+// normalizeResponseMode validates a configured response mode. An empty mode
+// leaves the choice to the provider, which is query for the code flow.
+func normalizeResponseMode(mode string) (string, error) {
+	switch strings.ToLower(mode) {
+	case "":
+		return "", nil
+	case ResponseModeQuery:
+		return ResponseModeQuery, nil
+	case ResponseModeFragment:
+		return ResponseModeFragment, nil
+	case ResponseModeFormPost, "form-post":
+		return ResponseModeFormPost, nil
+	default:
+		return "", fmt.Errorf("unsupported response mode '%s' (use query, fragment or form_post)", mode)
+	}
+}
+
+// fragmentRelayPage is served to the browser for response_mode=fragment. The
+// fragment never reaches the server, so the page posts it back to the
+// callback path, where it is handled like a form_post response. Everything
+// is relayed, even without a state, so that the callback handler rejects
+// bad responses instead of leaving the CLI waiting.
+const fragmentRelayPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Completing sign-in…</title>
+</head>
+<body>
+<p id="status">Completing sign-in…</p>
+<noscript><p>JavaScript is required to complete sign-in with response_mode=fragment.</p></noscript>
+<script>
+(function () {
+  var params = new URLSearchParams(window.location.hash.substring(1));
+  var form = document.createElement("form");
+  form.method = "post";
+  form.action = window.location.pathname;
+  params.forEach(function (value, key) {
+    var input = document.createElement("input");
+    input.type = "hidden";
+    input.name = key;
+    input.value = value;
+    form.appendChild(input);
+  });
+  document.body.appendChild(form);
+  form.submit();
+})();
+</script>
+</body>
+</html>`
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// revokeToken asks the provider to invalidate a token (RFC 7009). The
+// tokenTypeHint is "access_token" or "refresh_token".
+func revokeToken(ctx context.Context, appConfig AppConfig, token, tokenTypeHint string) error {
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return err
+	}
+	if metadata.RevocationEndpoint == "" {
+		return fmt.Errorf("provider has no revocation endpoint; set revocation_endpoint for the app")
+	}
+
+	data := url.Values{}
+	data.Set("token", token)
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
+
+	resp, err := postForm(ctx, appConfig, metadata.RevocationEndpoint, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The provider responds with 200 both for revoked and for already invalid tokens
+	if resp.StatusCode != http.StatusOK {
+		return parseTokenError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// interruptSignal records the signal that cancelled the invocation
+var interruptSignal atomic.Value
+
+// signalContext returns a context that is cancelled by SIGINT or SIGTERM, so
+// that flows can shut down cleanly. A second signal terminates immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			interruptSignal.Store(sig)
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// interruptExitCode returns the conventional exit code (128 + signal number)
+// if the invocation was interrupted, otherwise 0
+func interruptExitCode() int {
+	if sig, ok := interruptSignal.Load().(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return 0
+}
+
+// markInterrupted records a Ctrl-C that was read as input rather than
+// delivered as a signal, e.g. by a prompt with the terminal in raw mode
+func markInterrupted() {
+	interruptSignal.Store(syscall.SIGINT)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultFlowTimeout is how long to wait for the user to complete an
+	// interactive flow in the browser
+	defaultFlowTimeout = 5 * time.Minute
+	// defaultHTTPTimeout bounds each request to the provider
+	defaultHTTPTimeout = 10 * time.Second
+)
+
+// flowTimeout returns how long an app's interactive flows wait for the user
+func flowTimeout(appConfig AppConfig) (time.Duration, error) {
+	if appConfig.Timeout == "" {
+		return defaultFlowTimeout, nil
+	}
+	timeout, err := time.ParseDuration(appConfig.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout '%s': must be a positive duration such as 10m", appConfig.Timeout)
+	}
+	return timeout, nil
+}
+
+// httpClient returns the client for requests to an app's provider
+func httpClient(appConfig AppConfig) (*http.Client, error) {
+	if appConfig.HTTPTimeout == "" {
+		return &http.Client{Timeout: defaultHTTPTimeout}, nil
+	}
+	timeout, err := time.ParseDuration(appConfig.HTTPTimeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid http_timeout '%s': must be a positive duration such as 30s", appConfig.HTTPTimeout)
+	}
+	return &http.Client{Timeout: timeout}, nil
+}
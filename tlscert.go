@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// callbackCertLifetime is the validity period of the generated certificate
+const callbackCertLifetime = 365 * 24 * time.Hour
+
+// callbackTLSConfig returns the TLS configuration for an HTTPS callback
+// server, using the app's certificate and key or a generated self-signed one
+func callbackTLSConfig(appConfig AppConfig) (*tls.Config, error) {
+	certFile, keyFile := appConfig.CallbackCertFile, appConfig.CallbackKeyFile
+	if certFile == "" && keyFile == "" {
+		var err error
+		if certFile, keyFile, err = selfSignedCallbackCert(); err != nil {
+			return nil, fmt.Errorf("failed to create callback certificate: %v", err)
+		}
+	} else if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both callback_cert_file and callback_key_file must be set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load callback certificate: %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// selfSignedCallbackCert returns the cached self-signed certificate for the
+// loopback hosts, generating a new one when it is missing or about to expire
+func selfSignedCallbackCert() (string, string, error) {
+	dir := filepath.Join(dataDir(), "tls")
+	certFile := filepath.Join(dir, "localhost.crt")
+	keyFile := filepath.Join(dir, "localhost.key")
+
+	if data, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err == nil && time.Now().Add(24*time.Hour).Before(cert.NotAfter) {
+				if _, err := os.Stat(keyFile); err == nil {
+					return certFile, keyFile, nil
+				}
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "localhost", Organization: []string{"oauth-util"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(callbackCertLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", err
+	}
+
+	fmt.Fprintf(os.Stderr, "🔐 Generated a self-signed certificate for the callback server: %s\n", certFile)
+	fmt.Fprintln(os.Stderr, "   Your browser will warn about it until you trust it or accept the warning.")
+	return certFile, keyFile, nil
+}
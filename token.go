@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Supported OAuth2 grant types
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "device_code"
+	GrantPassword          = "password"
+)
+
+// TokenError is an error response returned by the token endpoint (RFC 6749 §5.2)
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+	URI         string
+}
+
+func (e *TokenError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	if e.Code != "" {
+		return e.Code
+	}
+	return fmt.Sprintf("request failed with status: %d", e.StatusCode)
+}
+
+// isInvalidGrant reports whether err is an invalid_grant token endpoint error
+func isInvalidGrant(err error) bool {
+	tokenErr, ok := err.(*TokenError)
+	return ok && tokenErr.Code == "invalid_grant"
+}
+
+// requestToken posts a grant request to the app's token endpoint
+func requestToken(ctx context.Context, appConfig AppConfig, data url.Values) (*TokenResponse, error) {
+	applyTokenParams(data, appConfig)
+
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make request
+	resp, err := postForm(ctx, appConfig, metadata.TokenEndpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseTokenError(resp)
+	}
+
+	// Parse response
+	var tokens TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %v", err)
+	}
+
+	// Validate the ID token before anything uses it
+	if appConfig.ValidateIDToken && tokens.IdToken != "" {
+		if err := validateIDToken(ctx, appConfig, tokens.IdToken, ""); err != nil {
+			return nil, fmt.Errorf("ID token validation failed: %v", err)
+		}
+	}
+
+	return &tokens, nil
+}
+
+// postForm sends an authenticated form POST to one of the provider's
+// client-authenticated endpoints (token, revocation, introspection, ...)
+func postForm(ctx context.Context, appConfig AppConfig, endpoint string, data url.Values) (*http.Response, error) {
+	// Authenticate the client
+	header := http.Header{}
+	if err := applyClientAuth(ctx, header, data, appConfig, endpoint); err != nil {
+		return nil, fmt.Errorf("client authentication failed: %v", err)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = header
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client, err := httpClient(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// parseTokenError builds a TokenError from an unsuccessful response
+func parseTokenError(resp *http.Response) *TokenError {
+	tokenErr := &TokenError{StatusCode: resp.StatusCode}
+	var errorResp struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+		ErrorURI         string `json:"error_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
+		tokenErr.Code = errorResp.Error
+		tokenErr.Description = errorResp.ErrorDescription
+		tokenErr.URI = errorResp.ErrorURI
+	}
+	return tokenErr
+}
+
+// refreshTokens exchanges a refresh token for a new set of tokens
+func refreshTokens(ctx context.Context, appConfig AppConfig, refreshToken string) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	if appConfig.Audience != "" {
+		data.Set("audience", appConfig.Audience)
+	}
+
+	tokens, err := requestToken(ctx, appConfig, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers that don't rotate refresh tokens omit them from the response,
+	// in which case the existing refresh token remains valid
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+	// ID tokens are optional on refresh, keep the one from the original login
+	if tokens.IdToken == "" {
+		tokens.IdToken = appConfig.IdToken
+	}
+
+	return tokens, nil
+}
+
+// clientCredentialsGrant requests an access token for the client itself (RFC 6749 §4.4)
+func clientCredentialsGrant(ctx context.Context, appConfig AppConfig) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	if appConfig.Scope != "" {
+		data.Set("scope", appConfig.Scope)
+	}
+	if appConfig.Audience != "" {
+		data.Set("audience", appConfig.Audience)
+	}
+
+	return requestToken(ctx, appConfig, data)
+}
+
+// obtainTokens acquires a new set of tokens using the app's grant type
+func obtainTokens(ctx context.Context, appConfig AppConfig, options FlowOptions) (*TokenResponse, error) {
+	switch appConfig.GrantType {
+	case "", GrantAuthorizationCode:
+		oauth := NewOAuthFlow()
+		return oauth.StartFlow(ctx, appConfig, options)
+	case GrantClientCredentials:
+		tokens, err := clientCredentialsGrant(ctx, appConfig)
+		if err != nil {
+			return nil, fmt.Errorf("client credentials grant failed: %v", err)
+		}
+		return tokens, nil
+	case GrantPassword:
+		tokens, err := passwordGrant(ctx, appConfig, options)
+		if err != nil {
+			return nil, fmt.Errorf("password grant failed: %v", err)
+		}
+		return tokens, nil
+	case GrantDeviceCode:
+		tokens, err := deviceCodeGrant(ctx, appConfig, options.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("device authorization failed: %v", err)
+		}
+		return tokens, nil
+	default:
+		return nil, fmt.Errorf("unsupported grant type '%s'", appConfig.GrantType)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// fetchUserInfo calls the OIDC userinfo endpoint with an access token. When
+// an ID token is given, the response must be about the same subject.
+func fetchUserInfo(ctx context.Context, appConfig AppConfig, accessToken, idToken string) (map[string]interface{}, error) {
+	metadata, err := discoverProvider(ctx, appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("provider has no userinfo endpoint; set userinfo_endpoint for the app")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", metadata.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	client, err := httpClient(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Bearer token errors are reported in the WWW-Authenticate header (RFC 6750 §3)
+		if challenge := resp.Header.Get("WWW-Authenticate"); challenge != "" {
+			return nil, fmt.Errorf("userinfo request failed with status %d: %s", resp.StatusCode, challenge)
+		}
+		return nil, fmt.Errorf("userinfo request failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signed userinfo responses are returned as a JWT
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/jwt") {
+		jwt, err := parseJWT(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse userinfo response: %v", err)
+		}
+		return jwt.Claims, verifyUserInfoSubject(jwt.Claims, idToken)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse userinfo response: %v", err)
+	}
+	return claims, verifyUserInfoSubject(claims, idToken)
+}
+
+// verifyUserInfoSubject checks that a userinfo response is about the user in
+// the ID token (OIDC Core §5.3.2), guarding against substituted responses
+func verifyUserInfoSubject(claims map[string]interface{}, idToken string) error {
+	if idToken == "" {
+		return nil
+	}
+	jwt, err := parseJWT(idToken)
+	if err != nil {
+		return fmt.Errorf("failed to parse stored ID token: %v", err)
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return fmt.Errorf("userinfo response has no sub claim")
+	}
+	if expected := jwt.ClaimString("sub"); sub != expected {
+		return fmt.Errorf("userinfo sub '%s' does not match ID token sub '%s'", sub, expected)
+	}
+	return nil
+}
+
+// identitySummary describes the identity in an ID token, e.g. "jane@example.com (sub: 1234)"
+func identitySummary(idToken string) string {
+	jwt, err := parseJWT(idToken)
+	if err != nil {
+		return ""
+	}
+
+	sub := jwt.ClaimString("sub")
+	name := jwt.ClaimString("email")
+	if name == "" {
+		name = jwt.ClaimString("preferred_username")
+	}
+
+	switch {
+	case name != "" && sub != "":
+		return fmt.Sprintf("%s (sub: %s)", name, sub)
+	case name != "":
+		return name
+	default:
+		return sub
+	}
+}
@@ -1,10 +1,24 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
+// hasScope reports whether a space-separated scope string includes scope
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // isValidURL checks if a string is a valid URL
 func isValidURL(input string) bool {
 	// Add scheme if missing
@@ -23,3 +37,57 @@ func formatURL(input string) string {
 	}
 	return input
 }
+
+// randomString returns n cryptographically random bytes encoded as unpadded base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// parsePortList parses a comma-separated list of ports and port ranges,
+// e.g. "3000,8400-8402". Port 0 requests any free port. Repeated ports are
+// only tried once.
+func parsePortList(input string) ([]string, error) {
+	var ports []string
+	seen := map[int]bool{}
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := parsePort(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%s'", part)
+		}
+		end := start
+		if isRange {
+			end, err = parsePort(last)
+			if err != nil || start == 0 || end < start {
+				return nil, fmt.Errorf("invalid port range '%s'", part)
+			}
+		}
+		for n := start; n <= end; n++ {
+			if !seen[n] {
+				seen[n] = true
+				ports = append(ports, strconv.Itoa(n))
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no callback port specified")
+	}
+	return ports, nil
+}
+
+// parsePort parses a single port number between 0 and 65535
+func parsePort(input string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || n < 0 || n > 65535 {
+		return 0, fmt.Errorf("invalid port '%s'", input)
+	}
+	return n, nil
+}
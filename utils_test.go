@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePortList(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: "3000", want: []string{"3000"}},
+		{input: "3000,3001", want: []string{"3000", "3001"}},
+		{input: " 3000 , 3001 ", want: []string{"3000", "3001"}},
+		{input: "8400-8402", want: []string{"8400", "8401", "8402"}},
+		{input: "3000,8400-8401,3001", want: []string{"3000", "8400", "8401", "3001"}},
+		{input: "8400-8400", want: []string{"8400"}},
+		{input: "3000,3000", want: []string{"3000"}},
+		{input: "8400-8402,8401", want: []string{"8400", "8401", "8402"}},
+		{input: "0", want: []string{"0"}},
+		{input: "3000,0", want: []string{"3000", "0"}},
+		{input: "65535", want: []string{"65535"}},
+		{input: "", wantErr: true},
+		{input: ",", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "65536", wantErr: true},
+		{input: "3000,99999", wantErr: true},
+		{input: "8402-8400", wantErr: true},
+		{input: "0-10", wantErr: true},
+		{input: "8400-", wantErr: true},
+		{input: "8400-70000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parsePortList(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortList(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePortList(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}